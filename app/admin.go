@@ -0,0 +1,137 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/server"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// Items returns every cached item
+func (a *App) Items() ([]cache.Item, error) {
+	return a.cache.Items()
+}
+
+// Item returns a cached item and its content
+func (a *App) Item(id string) (cache.Item, []byte, error) {
+	return a.cache.Get(id)
+}
+
+// AddItem stores a pushed item in the cache
+func (a *App) AddItem(data []byte, name string, meta cache.Metadata) (cache.Item, error) {
+	return a.cache.Store(data, name, meta)
+}
+
+// SetItemWindow sets when a cached item is published and when it expires
+func (a *App) SetItemWindow(id string, notBefore, notAfter time.Time) error {
+	return a.cache.SetWindow(id, notBefore, notAfter)
+}
+
+// DeleteItem removes an item from the cache
+func (a *App) DeleteItem(id string) error {
+	return a.cache.Delete(id)
+}
+
+// PinItem pins or unpins a cached item
+func (a *App) PinItem(id string, pinned bool) error {
+	return a.cache.SetPinned(id, pinned)
+}
+
+// BanItem bans an item's URL and content, returning the IDs of the deleted
+// items
+func (a *App) BanItem(id string) ([]string, error) {
+	return a.cache.Ban(id)
+}
+
+// Bans returns the banned URLs and content hashes
+func (a *App) Bans() (cache.Bans, error) {
+	return a.cache.Bans()
+}
+
+// AddBan bans a URL and/or content hash, returning the IDs of the deleted
+// items
+func (a *App) AddBan(url, hash string) ([]string, error) {
+	return a.cache.AddBan(url, hash)
+}
+
+// RemoveBan lifts the ban on a URL and/or content hash
+func (a *App) RemoveBan(url, hash string) error {
+	return a.cache.RemoveBan(url, hash)
+}
+
+// Fetch downloads from one provider immediately
+func (a *App) Fetch(provider string) error {
+	return a.services.Fetch(a.cache, provider)
+}
+
+// Providers returns the state of every content provider
+func (a *App) Providers() []services.ProviderState {
+	return a.services.Providers()
+}
+
+// SetProviderEnabled turns scheduled downloads from a provider on or off
+func (a *App) SetProviderEnabled(provider string, enabled bool) error {
+	return a.services.SetEnabled(provider, enabled)
+}
+
+// Workers returns the state of every background worker
+func (a *App) Workers() []server.WorkerState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	states := make([]server.WorkerState, 0, len(a.workers))
+	for name, w := range a.workers {
+		state := server.WorkerState{
+			Name:     name,
+			Interval: w.interval.String(),
+			Running:  w.running,
+			LastRun:  w.lastRun,
+		}
+		if w.lastErr != nil {
+			state.LastError = w.lastErr.Error()
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// SetWorkerInterval changes how often a background worker runs
+func (a *App) SetWorkerInterval(name string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s", interval)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.workers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", server.ErrUnknownWorker, name)
+	}
+	w.ticker.Reset(interval)
+	w.interval = interval
+	a.logger.Info("worker interval changed", "name", name, "interval", interval)
+	return nil
+}
+
+// Cleanup prunes the cache and saves rotation history, returning the IDs of
+// the removed items
+func (a *App) Cleanup() ([]string, error) {
+	removed, pruneErr := a.cache.Prune(cache.PruneOptions{MaxFiles: a.config.CacheMaxFiles})
+	if pruneErr != nil {
+		a.logger.Error("failed to cleanup cache", "error", pruneErr)
+		pruneErr = fmt.Errorf("failed to cleanup cache: %w", pruneErr)
+	}
+
+	saveErr := a.history.Save()
+	if saveErr != nil {
+		a.logger.Error("failed to save rotation history", "error", saveErr)
+		saveErr = fmt.Errorf("failed to save rotation history: %w", saveErr)
+	}
+	return removed, errors.Join(pruneErr, saveErr)
+}
@@ -2,27 +2,48 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stevielcb/motd-server/internal/cache"
 	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/httpclient"
+	"github.com/stevielcb/motd-server/internal/rotation"
+	"github.com/stevielcb/motd-server/internal/schedule"
 	"github.com/stevielcb/motd-server/internal/server"
 	"github.com/stevielcb/motd-server/internal/services"
+	"github.com/stevielcb/motd-server/internal/systemd"
 )
 
 // App represents the main application with all its dependencies
 type App struct {
-	config   *config.Config
-	cache    *cache.Manager
-	server   *server.TCPServer
-	services *services.Manager
-	logger   *slog.Logger
+	config    *config.Config
+	cache     *cache.Manager
+	server    *server.TCPServer
+	listeners []*server.TCPServer
+	http      *server.HTTPServer
+	admin     *server.HTTPServer
+	services  *services.Manager
+	history   *rotation.History
+	notifier  *systemd.Notifier
+	logger    *slog.Logger
 
-	// Background workers
-	downloadTicker *time.Ticker
-	cleanupTicker  *time.Ticker
+	// lastDownload is when the download worker last completed a cycle, used
+	// to decide whether to keep pinging the systemd watchdog
+	lastDownload atomic.Int64
+
+	// Background workers by name, guarded by mu
+	mu      sync.Mutex
+	workers map[string]*worker
 
 	// Context for graceful shutdown
 	ctx    context.Context
@@ -30,40 +51,425 @@ type App struct {
 	wg     sync.WaitGroup
 }
 
+// worker is a background task run on a ticker
+type worker struct {
+	ticker   *time.Ticker
+	interval time.Duration
+	running  bool
+	lastRun  time.Time
+	lastErr  error
+}
+
 // New creates a new application instance with all dependencies
 func New(cfg *config.Config, logger *slog.Logger) (*App, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Initialize the outbound HTTP client shared by downloads and providers
+	client, err := httpclient.FromConfig(cfg, logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	// Initialize cache manager
-	cacheManager, err := cache.NewManager(cfg.CacheDir, cfg.CacheMaxFiles, cfg.MaxFileSize, logger)
+	cacheManager, err := cache.NewManager(cfg.CacheDir, cfg.CacheMaxFiles, cfg.MaxFileSize, client, logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Initialize time-based content rules, shared by fetching and serving
+	sched, err := schedule.FromConfig(cfg)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 
 	// Initialize services manager
-	servicesManager, err := services.NewManager(cfg, logger)
+	servicesManager, err := services.NewManager(cfg, sched, client, logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Initialize per-client rotation history
+	history, err := rotation.NewHistory(cfg.HistoryWindow, time.Duration(cfg.HistoryTTL)*time.Second, cfg.HistoryFile)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Initialize caption templates, which listeners may override
+	loc, err := cfg.Location()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	captions, err := server.NewCaptions(cfg.Captions, cfg.Events, loc, logger)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 
-	// Initialize TCP server
-	tcpServer := server.NewTCPServer(cfg.ListenHost, cfg.ListenPort, cacheManager, logger)
+	// Limits are shared by every listener so they apply across the process
+	var rateLimiter *server.RateLimiter
+	if cfg.RateLimit > 0 {
+		rateLimiter = server.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	var connLimiter *server.ConnLimiter
+	if cfg.MaxConnections > 0 {
+		connLimiter = server.NewConnLimiter(cfg.MaxConnections, time.Duration(cfg.QueueTimeoutMs)*time.Millisecond)
+	}
+
+	serverOpts := []server.Option{
+		server.WithHistory(history),
+		server.WithSchedule(sched),
+		server.WithCaptions(captions),
+		server.WithRequestTimeout(time.Duration(cfg.RequestTimeoutMs) * time.Millisecond),
+		server.WithRateLimiter(rateLimiter),
+		server.WithConnLimiter(connLimiter),
+		server.WithWriteTimeout(time.Duration(cfg.WriteTimeout) * time.Second),
+		server.WithWeights(cache.Weights{
+			Groups:          cfg.SelectionWeights,
+			FreshnessBoost:  cfg.FreshnessBoost,
+			FreshnessWindow: time.Duration(cfg.FreshnessWindow) * time.Second,
+		}),
+	}
 
 	app := &App{
 		config:   cfg,
 		cache:    cacheManager,
-		server:   tcpServer,
 		services: servicesManager,
+		history:  history,
+		notifier: systemd.NewNotifier(),
 		logger:   logger,
 		ctx:      ctx,
 		cancel:   cancel,
 	}
 
+	// Initialize TCP servers, one per configured listener
+	listeners := tcpListeners(cfg)
+
+	// Take over any sockets passed in by systemd socket activation
+	names := make([]string, 0, len(listeners)+len(cfg.ScopedPorts)+1)
+	for _, l := range listeners {
+		names = append(names, l.Name)
+	}
+	for port := range cfg.ScopedPorts {
+		names = append(names, scopedListener(cfg, port).Name)
+	}
+	names = append(names, "http", "admin")
+	activated, err := systemd.Listeners()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sockets, err := matchSockets(activated, names)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	for _, l := range listeners {
+		policyOpts, err := listenerOptions(l)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if socket, ok := sockets[l.Name]; ok {
+			policyOpts = append(policyOpts, server.WithListener(socket))
+		}
+		if len(l.Captions) > 0 {
+			listenerCaptions, err := newListenerCaptions(cfg, l, loc, logger)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			policyOpts = append(policyOpts, server.WithCaptions(listenerCaptions))
+		}
+		tcpServer := server.NewTCPServer(l.Host, l.Port, cacheManager, logger, append(slices.Clone(serverOpts), policyOpts...)...)
+		if app.server == nil {
+			app.server = tcpServer
+		} else {
+			app.listeners = append(app.listeners, tcpServer)
+		}
+	}
+
+	// Initialize TCP servers serving a fixed subset of content
+	for port, query := range cfg.ScopedPorts {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid scope for port %d: %w", port, err)
+		}
+		l := scopedListener(cfg, port)
+		policyOpts, err := listenerOptions(l)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		opts := append(slices.Clone(serverOpts), policyOpts...)
+		opts = append(opts, server.WithScope(server.ParseScope(values)))
+		if socket, ok := sockets[l.Name]; ok {
+			opts = append(opts, server.WithListener(socket))
+		}
+		app.listeners = append(app.listeners, server.NewTCPServer(l.Host, l.Port, cacheManager, logger, opts...))
+	}
+
+	// The HTTP and admin servers share the default listener's TLS and ACL
+	acl, err := server.ParseACL(cfg.AllowCIDRs, cfg.DenyCIDRs)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("invalid http acl: %w", err)
+	}
+	httpPolicy := []server.Option{server.WithACL(acl)}
+	if cfg.TLSCertFile != "" {
+		httpPolicy = append(httpPolicy, server.WithTLS(server.TLSConfig{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+		}))
+	}
+
+	// Initialize optional HTTP server
+	if socket, ok := sockets["http"]; cfg.HTTPPort > 0 || ok {
+		httpOpts := append(slices.Clone(serverOpts), httpPolicy...)
+		if ok {
+			httpOpts = append(httpOpts, server.WithListener(socket))
+		}
+		app.http = server.NewHTTPServer(cfg.ListenHost, cfg.HTTPPort, cacheManager, logger, httpOpts...)
+	}
+
+	// Initialize optional admin API. It doesn't share the content servers'
+	// limits so operators can still reach it under load.
+	if socket, ok := sockets["admin"]; cfg.AdminPort > 0 || ok {
+		token := cfg.AdminTokenSecret()
+		if token == nil {
+			cancel()
+			return nil, fmt.Errorf("admin API needs MOTD_ADMIN_TOKEN, MOTD_ADMIN_TOKEN_FILE or MOTD_ADMIN_TOKEN_COMMAND")
+		}
+		if _, err := token.Get(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to read admin token: %w", err)
+		}
+		adminOpts := append([]server.Option{
+			server.WithName("admin"),
+			server.WithWriteTimeout(time.Duration(cfg.WriteTimeout) * time.Second),
+		}, httpPolicy...)
+		if ok {
+			adminOpts = append(adminOpts, server.WithListener(socket))
+		}
+		app.admin = server.NewAdminServer(cfg.AdminHost, cfg.AdminPort, app, token, logger, adminOpts...)
+	}
+
 	return app, nil
 }
 
+// Validate checks cfg the way New does without building the application:
+// it doesn't take over systemd sockets, read secrets or touch the cache
+func Validate(cfg *config.Config, logger *slog.Logger) error {
+	if _, err := httpclient.FromConfig(cfg, logger); err != nil {
+		return err
+	}
+	if _, err := schedule.FromConfig(cfg); err != nil {
+		return err
+	}
+	if err := services.ValidateConfig(cfg); err != nil {
+		return err
+	}
+
+	loc, err := cfg.Location()
+	if err != nil {
+		return err
+	}
+	if _, err := server.NewCaptions(cfg.Captions, cfg.Events, loc, logger); err != nil {
+		return err
+	}
+
+	for _, l := range tcpListeners(cfg) {
+		if _, err := listenerOptions(l); err != nil {
+			return err
+		}
+		if len(l.Captions) > 0 {
+			if _, err := newListenerCaptions(cfg, l, loc, logger); err != nil {
+				return err
+			}
+		}
+	}
+	for port, query := range cfg.ScopedPorts {
+		if _, err := url.ParseQuery(query); err != nil {
+			return fmt.Errorf("invalid scope for port %d: %w", port, err)
+		}
+		if _, err := listenerOptions(scopedListener(cfg, port)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := server.ParseACL(cfg.AllowCIDRs, cfg.DenyCIDRs); err != nil {
+		return fmt.Errorf("invalid http acl: %w", err)
+	}
+	if cfg.AdminPort > 0 && cfg.AdminTokenSecret() == nil {
+		return fmt.Errorf("admin API needs MOTD_ADMIN_TOKEN, MOTD_ADMIN_TOKEN_FILE or MOTD_ADMIN_TOKEN_COMMAND")
+	}
+	return nil
+}
+
+// tcpListeners returns the configured listeners, or the default listener
+// built from the top-level settings when none are configured
+func tcpListeners(cfg *config.Config) config.Listeners {
+	if len(cfg.Listeners) > 0 {
+		return cfg.Listeners
+	}
+	listeners := config.Listeners{{
+		Name:            "default",
+		Host:            cfg.ListenHost,
+		Port:            cfg.ListenPort,
+		TLSCertFile:     cfg.TLSCertFile,
+		TLSKeyFile:      cfg.TLSKeyFile,
+		TLSClientCAFile: cfg.TLSClientCAFile,
+		Allow:           cfg.AllowCIDRs,
+		Deny:            cfg.DenyCIDRs,
+		ProxyProtocol:   cfg.ProxyProtocol,
+		TrustedProxies:  cfg.TrustedProxies,
+	}}
+	if cfg.ListenSocket != "" {
+		listeners = append(listeners, config.Listener{
+			Name:        "socket",
+			Socket:      cfg.ListenSocket,
+			SocketMode:  cfg.ListenSocketMode,
+			SocketOwner: cfg.ListenSocketOwner,
+		})
+	}
+	return listeners
+}
+
+// scopedListener returns the listener for a scoped port. It shares the
+// default listener's ACL, TLS and PROXY protocol settings.
+func scopedListener(cfg *config.Config, port int) config.Listener {
+	return config.Listener{
+		Name:            fmt.Sprintf("scoped-%d", port),
+		Host:            cfg.ListenHost,
+		Port:            port,
+		TLSCertFile:     cfg.TLSCertFile,
+		TLSKeyFile:      cfg.TLSKeyFile,
+		TLSClientCAFile: cfg.TLSClientCAFile,
+		Allow:           cfg.AllowCIDRs,
+		Deny:            cfg.DenyCIDRs,
+		ProxyProtocol:   cfg.ProxyProtocol,
+		TrustedProxies:  cfg.TrustedProxies,
+	}
+}
+
+// newListenerCaptions builds captions from the global templates with the
+// listener's overrides applied
+func newListenerCaptions(cfg *config.Config, l config.Listener, loc *time.Location, logger *slog.Logger) (*server.Captions, error) {
+	templates := maps.Clone(cfg.Captions)
+	if templates == nil {
+		templates = make(config.Captions)
+	}
+	maps.Copy(templates, l.Captions)
+	captions, err := server.NewCaptions(templates, cfg.Events, loc, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener %s: %w", l.Name, err)
+	}
+	return captions, nil
+}
+
+// listenerOptions converts a listener's content policy into server options
+func listenerOptions(l config.Listener) ([]server.Option, error) {
+	if l.MaxRating != "" && !cache.ValidRating(l.MaxRating) {
+		return nil, fmt.Errorf("invalid max rating %q for listener %s", l.MaxRating, l.Name)
+	}
+
+	format, err := server.ParseFormat(l.Format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener %s: %w", l.Name, err)
+	}
+
+	acl, err := server.ParseACL(l.Allow, l.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acl for listener %s: %w", l.Name, err)
+	}
+
+	proxyMode, err := server.ParseProxyMode(l.ProxyProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener %s: %w", l.Name, err)
+	}
+
+	trusted, err := server.ParseTrustedProxies(l.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies for listener %s: %w", l.Name, err)
+	}
+	if proxyMode != server.ProxyOff && l.Socket == "" && len(trusted) == 0 {
+		return nil, fmt.Errorf("listener %s reads PROXY headers, so it needs trusted proxies", l.Name)
+	}
+
+	opts := []server.Option{
+		server.WithName(l.Name),
+		server.WithACL(acl),
+		server.WithProxyProtocol(proxyMode),
+		server.WithTrustedProxies(trusted),
+		server.WithPolicy(cache.Policy{
+			Scope:     cache.Scope{Tags: l.Tags, Sources: l.Sources},
+			MaxRating: l.MaxRating,
+		}),
+		server.WithFormat(format),
+	}
+
+	if l.TLSCertFile != "" || l.TLSKeyFile != "" {
+		if l.TLSCertFile == "" || l.TLSKeyFile == "" {
+			return nil, fmt.Errorf("listener %s needs both a TLS certificate and key", l.Name)
+		}
+		opts = append(opts, server.WithTLS(server.TLSConfig{
+			CertFile:     l.TLSCertFile,
+			KeyFile:      l.TLSKeyFile,
+			ClientCAFile: l.TLSClientCAFile,
+		}))
+	}
+
+	if l.Socket != "" {
+		var mode uint64
+		if l.SocketMode != "" {
+			mode, err = strconv.ParseUint(l.SocketMode, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid socket mode %q for listener %s: %w", l.SocketMode, l.Name, err)
+			}
+		}
+		opts = append(opts, server.WithUnixSocket(l.Socket, os.FileMode(mode), l.SocketOwner))
+	}
+
+	return opts, nil
+}
+
+// matchSockets assigns sockets passed in by systemd to the listeners with the
+// same name (FileDescriptorName= in the socket unit). A single socket
+// matching no listener is used by the first one, so a plain socket unit
+// works without naming.
+func matchSockets(activated []systemd.Socket, names []string) (map[string]net.Listener, error) {
+	sockets := make(map[string]net.Listener)
+	var unmatched []systemd.Socket
+	for _, socket := range activated {
+		if _, taken := sockets[socket.Name]; !taken && slices.Contains(names, socket.Name) {
+			sockets[socket.Name] = socket.Listener
+		} else {
+			unmatched = append(unmatched, socket)
+		}
+	}
+
+	if _, taken := sockets[names[0]]; len(unmatched) == 1 && !taken {
+		sockets[names[0]] = unmatched[0].Listener
+		unmatched = nil
+	}
+
+	if len(unmatched) > 0 {
+		for _, socket := range activated {
+			socket.Listener.Close()
+		}
+		return nil, fmt.Errorf("activated socket %q matches no listener", unmatched[0].Name)
+	}
+	return sockets, nil
+}
+
 // Start begins all application services
 func (a *App) Start() error {
 	a.logger.Info("starting motd-server")
@@ -71,69 +477,238 @@ func (a *App) Start() error {
 	// Start background workers
 	a.startBackgroundWorkers()
 
+	// Start additional listeners and the HTTP server alongside the main TCP server
+	for _, listener := range a.listeners {
+		go func() {
+			if err := listener.Start(); err != nil {
+				a.logger.Error("listener failed", "error", err)
+			}
+		}()
+	}
+	if a.http != nil {
+		go func() {
+			if err := a.http.Start(); err != nil {
+				a.logger.Error("http server failed", "error", err)
+			}
+		}()
+	}
+	if a.admin != nil {
+		go func() {
+			if err := a.admin.Start(); err != nil {
+				a.logger.Error("admin server failed", "error", err)
+			}
+		}()
+	}
+
+	// Tell systemd we're ready once every server is listening
+	go a.notifyReady()
+
 	// Start TCP server
 	return a.server.Start()
 }
 
-// Stop gracefully shuts down the application
-func (a *App) Stop() error {
+// notifyReady sends the systemd readiness notification once all servers
+// are listening
+func (a *App) notifyReady() {
+	ready := []<-chan struct{}{a.server.Ready()}
+	for _, listener := range a.listeners {
+		ready = append(ready, listener.Ready())
+	}
+	if a.http != nil {
+		ready = append(ready, a.http.Ready())
+	}
+	if a.admin != nil {
+		ready = append(ready, a.admin.Ready())
+	}
+
+	for _, r := range ready {
+		select {
+		case <-r:
+		case <-a.ctx.Done():
+			return
+		}
+	}
+
+	if err := a.notifier.Ready(); err != nil {
+		a.logger.Warn("failed to notify systemd", "error", err)
+	}
+}
+
+// Stop gracefully shuts down the application, waiting until ctx is done for
+// in-flight responses to finish
+func (a *App) Stop(ctx context.Context) error {
 	a.logger.Info("stopping motd-server")
+	if err := a.notifier.Stopping(); err != nil {
+		a.logger.Warn("failed to notify systemd", "error", err)
+	}
 
 	// Cancel context to stop background workers
 	a.cancel()
 
 	// Stop tickers
-	if a.downloadTicker != nil {
-		a.downloadTicker.Stop()
+	a.mu.Lock()
+	for _, w := range a.workers {
+		w.ticker.Stop()
 	}
-	if a.cleanupTicker != nil {
-		a.cleanupTicker.Stop()
+	a.mu.Unlock()
+
+	// Wait for running downloads and cleanups to finish, but no longer than
+	// the shutdown deadline allows
+	workersDone := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		a.logger.Warn("background workers still running at shutdown deadline")
 	}
 
-	// Wait for all goroutines to finish
-	a.wg.Wait()
+	// Persist rotation history
+	if err := a.history.Save(); err != nil {
+		a.logger.Error("failed to save rotation history", "error", err)
+	}
 
-	// Stop server
-	return a.server.Stop()
+	// Stop servers, draining them concurrently so they share the deadline
+	var servers sync.WaitGroup
+	for _, listener := range a.listeners {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := listener.Stop(ctx); err != nil {
+				a.logger.Error("failed to stop listener", "error", err)
+			}
+		}()
+	}
+	if a.http != nil {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := a.http.Stop(ctx); err != nil {
+				a.logger.Error("failed to stop http server", "error", err)
+			}
+		}()
+	}
+	if a.admin != nil {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := a.admin.Stop(ctx); err != nil {
+				a.logger.Error("failed to stop admin server", "error", err)
+			}
+		}()
+	}
+	err := a.server.Stop(ctx)
+	servers.Wait()
+	return err
 }
 
 // startBackgroundWorkers starts the download and cleanup goroutines
 func (a *App) startBackgroundWorkers() {
-	// Download worker
-	a.downloadTicker = time.NewTicker(time.Duration(a.config.DownloadInterval) * time.Second)
+	a.lastDownload.Store(time.Now().UnixNano())
+	a.startWorker("download", time.Duration(a.config.DownloadInterval)*time.Second, a.download)
+
+	// Watchdog worker, only pinging while the download worker makes progress
+	if interval, ok := systemd.WatchdogInterval(); ok && a.notifier != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.logger.Info("starting watchdog worker", "interval", interval)
+			a.runWatchdog(interval)
+		}()
+	}
+
+	a.startWorker("cleanup", time.Duration(a.config.CleanupInterval)*time.Second, func() error {
+		_, err := a.Cleanup()
+		return err
+	})
+}
+
+// startWorker calls run each time the interval passes until the application
+// stops
+func (a *App) startWorker(name string, interval time.Duration, run func() error) {
+	w := &worker{ticker: time.NewTicker(interval), interval: interval}
+	a.mu.Lock()
+	if a.workers == nil {
+		a.workers = make(map[string]*worker)
+	}
+	a.workers[name] = w
+	a.mu.Unlock()
+
 	a.wg.Add(1)
 	go func() {
 		defer a.wg.Done()
-		a.logger.Info("starting MOTD download worker", "interval", a.config.DownloadInterval)
+		a.logger.Info("starting worker", "name", name, "interval", interval)
 
 		for {
 			select {
-			case <-a.downloadTicker.C:
-				if err := a.services.DownloadMOTDs(a.cache); err != nil {
-					a.logger.Error("failed to download MOTDs", "error", err)
-				}
+			case <-w.ticker.C:
+				a.mu.Lock()
+				w.running = true
+				a.mu.Unlock()
+
+				err := run()
+
+				a.mu.Lock()
+				w.running = false
+				w.lastRun = time.Now()
+				w.lastErr = err
+				a.mu.Unlock()
 			case <-a.ctx.Done():
 				return
 			}
 		}
 	}()
+}
 
-	// Cleanup worker
-	a.cleanupTicker = time.NewTicker(time.Duration(a.config.CleanupInterval) * time.Second)
-	a.wg.Add(1)
-	go func() {
-		defer a.wg.Done()
-		a.logger.Info("starting cleanup worker", "interval", a.config.CleanupInterval)
+// download runs one download pass and reports it to systemd
+func (a *App) download() error {
+	status := "last download at " + time.Now().Format(time.TimeOnly)
+	err := a.services.DownloadMOTDs(a.cache)
+	if err != nil {
+		a.logger.Error("failed to download MOTDs", "error", err)
+		status = "download failed: " + err.Error()
+	}
+	a.lastDownload.Store(time.Now().UnixNano())
+	if err := a.notifier.Status(status); err != nil {
+		a.logger.Warn("failed to notify systemd", "error", err)
+	}
+	return err
+}
 
-		for {
-			select {
-			case <-a.cleanupTicker.C:
-				if err := a.cache.Cleanup(); err != nil {
-					a.logger.Error("failed to cleanup cache", "error", err)
-				}
-			case <-a.ctx.Done():
-				return
+// workerInterval returns how often the named worker runs, or fallback if it
+// hasn't started
+func (a *App) workerInterval(name string, fallback time.Duration) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w, ok := a.workers[name]; ok {
+		return w.interval
+	}
+	return fallback
+}
+
+// runWatchdog pings the systemd watchdog at half its interval for as long as
+// the download worker is healthy, so a wedged worker gets the service
+// restarted
+func (a *App) runWatchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// The download interval can change at runtime
+			stale := max(3*a.workerInterval("download", time.Duration(a.config.DownloadInterval)*time.Second), interval)
+			if since := time.Since(time.Unix(0, a.lastDownload.Load())); since > stale {
+				a.logger.Warn("download worker unresponsive, withholding watchdog ping", "since", since)
+				continue
 			}
+			if err := a.notifier.Watchdog(); err != nil {
+				a.logger.Warn("failed to notify systemd", "error", err)
+			}
+		case <-a.ctx.Done():
+			return
 		}
-	}()
+	}
 }
@@ -1,14 +1,20 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"net"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/server"
+	"github.com/stevielcb/motd-server/internal/systemd"
 )
 
 func TestNew(t *testing.T) {
@@ -162,7 +168,7 @@ func TestApp_StartAndStop(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Stop the app
-	if err := app.Stop(); err != nil {
+	if err := app.Stop(context.Background()); err != nil {
 		t.Errorf("failed to stop app: %v", err)
 	}
 
@@ -222,10 +228,378 @@ func TestApp_BackgroundWorkers(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Stop the app
-	if err := app.Stop(); err != nil {
+	if err := app.Stop(context.Background()); err != nil {
 		t.Errorf("failed to stop app: %v", err)
 	}
 
 	// Wait for workers to stop
 	app.wg.Wait()
 }
+
+func TestApp_StopDeadline(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		CacheDir:         tempDir,
+		CacheMaxFiles:    50,
+		DownloadInterval: 3600,
+		CleanupInterval:  3600,
+		ListenHost:       "localhost",
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	app, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+
+	// A worker stuck in a slow download must not hold up shutdown
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	app.startWorker("slow", time.Millisecond, func() error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	app.Stop(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop() took %s, want it bounded by the context", elapsed)
+	}
+}
+
+func TestNew_ScopedPortACL(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := &config.Config{
+		CacheDir:         t.TempDir(),
+		CacheMaxFiles:    50,
+		DownloadInterval: 3600,
+		CleanupInterval:  3600,
+		ListenHost:       "127.0.0.1",
+		ScopedPorts:      map[int]string{port: "source=xkcd"},
+		DenyCIDRs:        []string{"127.0.0.0/8"},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	app, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+	if len(app.listeners) != 1 {
+		t.Fatalf("expected 1 scoped listener, got %d", len(app.listeners))
+	}
+	scoped := app.listeners[0]
+	go scoped.Start()
+	defer scoped.Stop(context.Background())
+	<-scoped.Ready()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if response, _ := io.ReadAll(conn); len(response) != 0 {
+		t.Errorf("expected denied client to get nothing, got %q", response)
+	}
+	if stats := scoped.Stats(); stats.Denied != 1 {
+		t.Errorf("expected 1 denied connection, got %+v", stats)
+	}
+}
+
+func TestNew_Listeners(t *testing.T) {
+	tempDir := t.TempDir()
+
+	apiKeyFile := tempDir + "/giphy-api"
+	if err := os.WriteFile(apiKeyFile, []byte("test-api-key"), 0644); err != nil {
+		t.Fatalf("failed to create test API key file: %v", err)
+	}
+
+	cfg := &config.Config{
+		CacheDir:         tempDir,
+		CacheMaxFiles:    50,
+		GiphyApiKeyFile:  apiKeyFile,
+		DownloadInterval: 10,
+		CleanupInterval:  60,
+		Listeners: config.Listeners{
+			{Name: "work", Host: "localhost", Port: 0, MaxRating: "g", Format: "text"},
+			{Name: "personal", Host: "localhost", Port: 0},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	app, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+
+	if app.server == nil {
+		t.Error("expected primary server for first listener")
+	}
+	if len(app.listeners) != 1 {
+		t.Errorf("expected 1 additional listener, got %d", len(app.listeners))
+	}
+
+	cfg.Listeners[0].Format = "sixel"
+	if _, err := New(cfg, logger); err == nil {
+		t.Error("expected error for invalid listener format but got none")
+	}
+	cfg.Listeners[0].Format = "text"
+
+	cfg.Listeners[1].ProxyProtocol = "strict"
+	if _, err := New(cfg, logger); err == nil {
+		t.Error("expected error for PROXY headers without trusted proxies but got none")
+	}
+	cfg.Listeners[1].TrustedProxies = []string{"10.0.0.5"}
+	if _, err := New(cfg, logger); err != nil {
+		t.Errorf("failed to create app with trusted proxies: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr string
+	}{
+		{name: "defaults", cfg: config.Config{ListenPort: 4200}},
+		{
+			name: "admin token from command",
+			cfg:  config.Config{AdminPort: 4280, AdminTokenCommand: "exit 1"},
+		},
+		{name: "admin without token", cfg: config.Config{AdminPort: 4280}, wantErr: "admin API needs"},
+		{
+			name:    "listener format",
+			cfg:     config.Config{Listeners: config.Listeners{{Name: "work", Format: "sixel"}}},
+			wantErr: "invalid listener work",
+		},
+		{
+			name: "scoped port proxy",
+			cfg: config.Config{
+				Listeners:     config.Listeners{{Name: "work"}},
+				ScopedPorts:   map[int]string{4201: "source=xkcd"},
+				ProxyProtocol: "strict",
+			},
+			wantErr: "listener scoped-4201 reads PROXY headers",
+		},
+		{name: "http acl", cfg: config.Config{AllowCIDRs: []string{"nope"}}, wantErr: "acl"},
+		{name: "giphy mode", cfg: config.Config{GiphyModes: map[string]string{"cats": "nope"}}, wantErr: "invalid giphy mode"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.cfg, logger)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchSockets(t *testing.T) {
+	tests := []struct {
+		name      string
+		sockets   []string
+		listeners []string
+		want      map[string]string // listener name to socket name
+		wantErr   bool
+	}{
+		{
+			name:      "matched by name",
+			sockets:   []string{"http", "work"},
+			listeners: []string{"work", "personal", "http"},
+			want:      map[string]string{"work": "work", "http": "http"},
+		},
+		{
+			name:      "single unnamed socket goes to first listener",
+			sockets:   []string{"motd-server.socket"},
+			listeners: []string{"default", "http"},
+			want:      map[string]string{"default": "motd-server.socket"},
+		},
+		{
+			name:      "first listener already matched",
+			sockets:   []string{"default", "other"},
+			listeners: []string{"default", "http"},
+			wantErr:   true,
+		},
+		{
+			name:      "several unmatched sockets",
+			sockets:   []string{"one", "two"},
+			listeners: []string{"default"},
+			wantErr:   true,
+		},
+		{
+			name:      "no sockets",
+			listeners: []string{"default"},
+			want:      map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var activated []systemd.Socket
+			byListener := make(map[net.Listener]string)
+			for _, name := range tt.sockets {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				defer l.Close()
+				activated = append(activated, systemd.Socket{Name: name, Listener: l})
+				byListener[l] = name
+			}
+
+			sockets, err := matchSockets(activated, tt.listeners)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make(map[string]string)
+			for name, l := range sockets {
+				got[name] = byListener[l]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApp_NotifyReady(t *testing.T) {
+	tempDir := t.TempDir()
+
+	notifyPath := tempDir + "/notify.sock"
+	notifyConn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifyPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen for notifications: %v", err)
+	}
+	defer notifyConn.Close()
+	t.Setenv("NOTIFY_SOCKET", notifyPath)
+
+	apiKeyFile := tempDir + "/giphy-api"
+	if err := os.WriteFile(apiKeyFile, []byte("test-api-key"), 0644); err != nil {
+		t.Fatalf("failed to create test API key file: %v", err)
+	}
+
+	cfg := &config.Config{
+		CacheDir:         tempDir,
+		CacheMaxFiles:    50,
+		GiphyApiKeyFile:  apiKeyFile,
+		DownloadInterval: 10,
+		CleanupInterval:  60,
+		ListenHost:       "127.0.0.1",
+		ListenPort:       0,
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	app, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+
+	go app.Start()
+	defer app.Stop(context.Background())
+
+	buf := make([]byte, 256)
+	notifyConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := notifyConn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("expected READY=1, got %q", got)
+	}
+}
+
+func TestApp_Workers(t *testing.T) {
+	tempDir := t.TempDir()
+	apiKeyFile := tempDir + "/giphy-api"
+	if err := os.WriteFile(apiKeyFile, []byte("test-api-key"), 0600); err != nil {
+		t.Fatalf("failed to create test API key file: %v", err)
+	}
+	tokenFile := tempDir + "/admin-token"
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("failed to create admin token file: %v", err)
+	}
+
+	cfg := &config.Config{
+		CacheDir:         tempDir,
+		CacheMaxFiles:    50,
+		GiphyApiKeyFile:  apiKeyFile,
+		DownloadInterval: 3600,
+		CleanupInterval:  3600,
+		ListenHost:       "localhost",
+		AdminHost:        "localhost",
+		AdminPort:        4299,
+		AdminTokenFile:   tokenFile,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	app, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+	if app.admin == nil {
+		t.Fatal("expected admin server")
+	}
+
+	app.startBackgroundWorkers()
+	defer func() {
+		app.cancel()
+		app.wg.Wait()
+	}()
+
+	workers := app.Workers()
+	if len(workers) != 2 || workers[0].Name != "cleanup" || workers[1].Name != "download" || workers[1].Interval != "1h0m0s" {
+		t.Fatalf("unexpected workers %+v", workers)
+	}
+
+	if err := app.SetWorkerInterval("download", time.Minute); err != nil {
+		t.Fatalf("SetWorkerInterval() error = %v", err)
+	}
+	if got := app.Workers()[1].Interval; got != "1m0s" {
+		t.Errorf("interval = %s, want 1m0s", got)
+	}
+	if err := app.SetWorkerInterval("nope", time.Minute); !errors.Is(err, server.ErrUnknownWorker) {
+		t.Errorf("expected ErrUnknownWorker, got %v", err)
+	}
+
+	if _, err := app.Cleanup(); err != nil {
+		t.Errorf("Cleanup() error = %v", err)
+	}
+
+	// The admin API needs a token
+	cfg.AdminTokenFile = ""
+	if _, err := New(cfg, logger); err == nil {
+		t.Error("expected error without an admin token file")
+	}
+}
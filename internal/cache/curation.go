@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// bansFile holds banned URLs and content hashes, beside the cached files
+const bansFile = ".bans.json"
+
+// ErrBanned is returned when asked to cache banned content
+var ErrBanned = errors.New("content is banned")
+
+// ErrInvalidWindow is returned for a publishing window that ends before it
+// starts
+var ErrInvalidWindow = errors.New("invalid publishing window")
+
+// Bans lists content that must never be cached
+type Bans struct {
+	URLs   []string `json:"urls,omitempty"`
+	Hashes []string `json:"sha256,omitempty"`
+}
+
+// emptyHash is the hash of empty content, which is never banned as it would
+// match everything stored without any
+var emptyHash = contentHash(nil)
+
+// contentHash returns the hex encoded SHA-256 of downloaded content
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Bans returns the banned URLs and content hashes. The list is read from
+// disk each time so bans made by the CLI apply to a running server.
+func (m *Manager) Bans() (Bans, error) {
+	var bans Bans
+
+	dat, err := os.ReadFile(filepath.Join(m.cacheDir, bansFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return bans, nil
+	}
+	if err != nil {
+		return bans, fmt.Errorf("failed to read bans: %w", err)
+	}
+
+	if err := json.Unmarshal(dat, &bans); err != nil {
+		return bans, fmt.Errorf("failed to parse bans: %w", err)
+	}
+	return bans, nil
+}
+
+// writeBans replaces the ban list on disk
+func (m *Manager) writeBans(bans Bans) error {
+	dat, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bans: %w", err)
+	}
+
+	path := filepath.Join(m.cacheDir, bansFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return fmt.Errorf("failed to write bans: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write bans: %w", err)
+	}
+	return nil
+}
+
+// banned reports whether a URL or content hash has been banned
+func (b Bans) banned(url, hash string) bool {
+	return (url != "" && slices.Contains(b.URLs, url)) ||
+		(hash != "" && hash != emptyHash && slices.Contains(b.Hashes, hash))
+}
+
+// AddBan bans a URL and/or content hash, deleting any cached items that
+// match. It returns the IDs of the deleted items.
+func (m *Manager) AddBan(url, hash string) ([]string, error) {
+	if url == "" && hash == "" {
+		return nil, fmt.Errorf("nothing to ban")
+	}
+	if hash == emptyHash {
+		return nil, fmt.Errorf("refusing to ban the hash of empty content")
+	}
+
+	bans, err := m.Bans()
+	if err != nil {
+		return nil, err
+	}
+	if url != "" && !slices.Contains(bans.URLs, url) {
+		bans.URLs = append(bans.URLs, url)
+	}
+	if hash != "" && !slices.Contains(bans.Hashes, hash) {
+		bans.Hashes = append(bans.Hashes, hash)
+	}
+	if err := m.writeBans(bans); err != nil {
+		return nil, err
+	}
+
+	items, err := m.Items()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, item := range items {
+		if !bans.banned(item.URL, item.SHA256) {
+			continue
+		}
+		if err := m.removeItem(item.ID); err != nil {
+			m.logger.Error("failed to remove banned item", "id", item.ID, "error", err)
+			continue
+		}
+		deleted = append(deleted, item.ID)
+	}
+
+	m.logger.Info("banned content", "url", url, "sha256", hash, "deleted", len(deleted))
+	return deleted, nil
+}
+
+// Ban bans a cached item's source URL and content hash and deletes it, along
+// with any other items sharing them
+func (m *Manager) Ban(id string) ([]string, error) {
+	item, _, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	hash := item.SHA256
+	if hash == emptyHash {
+		// Text items cached before their message was hashed
+		hash = ""
+	}
+	return m.AddBan(item.URL, hash)
+}
+
+// RemoveBan lifts a ban on a URL and/or content hash
+func (m *Manager) RemoveBan(url, hash string) error {
+	bans, err := m.Bans()
+	if err != nil {
+		return err
+	}
+
+	bans.URLs = slices.DeleteFunc(bans.URLs, func(u string) bool { return u == url })
+	bans.Hashes = slices.DeleteFunc(bans.Hashes, func(h string) bool { return h == hash })
+	return m.writeBans(bans)
+}
+
+// SetPinned pins or unpins a cached item. Pinned items are never removed by
+// Cleanup and don't count towards the cache's file limit.
+func (m *Manager) SetPinned(id string, pinned bool) error {
+	item, _, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	item.Pinned = pinned
+	return m.writeMetadata(id, item.Metadata)
+}
+
+// SetWindow sets when a cached item is published and when it expires. Zero
+// times leave that end of the window open.
+func (m *Manager) SetWindow(id string, notBefore, notAfter time.Time) error {
+	if !notBefore.IsZero() && !notAfter.IsZero() && !notBefore.Before(notAfter) {
+		return fmt.Errorf("%w: not_before must be before not_after", ErrInvalidWindow)
+	}
+
+	item, _, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	item.NotBefore = notBefore
+	item.NotAfter = notAfter
+	return m.writeMetadata(id, item.Metadata)
+}
+
+// Delete removes a cached item and its metadata
+func (m *Manager) Delete(id string) error {
+	if _, _, err := m.Get(id); err != nil {
+		return err
+	}
+	return m.removeItem(id)
+}
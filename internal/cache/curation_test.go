@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager_Ban(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Two URLs serve the same content, so banning one's hash blocks both
+		if r.URL.Path == "/dog.gif" {
+			w.Write([]byte("dog"))
+			return
+		}
+		w.Write([]byte("cat"))
+	}))
+	defer srv.Close()
+
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	for _, path := range []string{"/cat.gif", "/dog.gif"} {
+		if err := manager.WriteItem(srv.URL+path, Metadata{Provider: "giphy"}); err != nil {
+			t.Fatalf("failed to write item: %v", err)
+		}
+	}
+
+	items, err := manager.Items()
+	if err != nil {
+		t.Fatalf("failed to list items: %v", err)
+	}
+	var cat Item
+	for _, item := range items {
+		if item.URL == srv.URL+"/cat.gif" {
+			cat = item
+		}
+	}
+	if cat.SHA256 != contentHash([]byte("cat")) {
+		t.Fatalf("expected content hash to be recorded, got %+v", cat)
+	}
+
+	deleted, err := manager.Ban(cat.ID)
+	if err != nil {
+		t.Fatalf("failed to ban item: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != cat.ID {
+		t.Errorf("expected only the banned item to be deleted, got %v", deleted)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantBanned bool
+	}{
+		{name: "banned url", url: srv.URL + "/cat.gif", wantBanned: true},
+		{name: "banned content at another url", url: srv.URL + "/cat-again.gif", wantBanned: true},
+		{name: "other content", url: srv.URL + "/dog.gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.WriteItem(tt.url, Metadata{Provider: "giphy"})
+			if got := errors.Is(err, ErrBanned); got != tt.wantBanned {
+				t.Errorf("expected banned %v, got error %v", tt.wantBanned, err)
+			}
+		})
+	}
+
+	// Lifting the URL ban still leaves the content hash banned
+	if err := manager.RemoveBan(srv.URL+"/cat.gif", ""); err != nil {
+		t.Fatalf("failed to remove ban: %v", err)
+	}
+	if err := manager.WriteItem(srv.URL+"/cat.gif", Metadata{}); !errors.Is(err, ErrBanned) {
+		t.Errorf("expected content hash ban to remain, got %v", err)
+	}
+	if err := manager.RemoveBan("", cat.SHA256); err != nil {
+		t.Fatalf("failed to remove ban: %v", err)
+	}
+	if err := manager.WriteItem(srv.URL+"/cat.gif", Metadata{}); err != nil {
+		t.Errorf("expected write after lifting bans to succeed, got %v", err)
+	}
+}
+
+func TestManager_Ban_Text(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	spam, err := manager.Store(nil, "", Metadata{Provider: "custom", Message: "buy now"})
+	if err != nil {
+		t.Fatalf("failed to store text: %v", err)
+	}
+	keep, err := manager.Store(nil, "", Metadata{Provider: "custom", Message: "on-call: alice"})
+	if err != nil {
+		t.Fatalf("failed to store text: %v", err)
+	}
+
+	deleted, err := manager.Ban(spam.ID)
+	if err != nil {
+		t.Fatalf("Ban() error = %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != spam.ID {
+		t.Errorf("deleted = %v, want only %s", deleted, spam.ID)
+	}
+	if _, _, err := manager.Get(keep.ID); err != nil {
+		t.Errorf("expected other text item to survive, got %v", err)
+	}
+
+	if _, err := manager.Store(nil, "", Metadata{Provider: "custom", Message: "release shipped"}); err != nil {
+		t.Errorf("expected new text push to succeed, got %v", err)
+	}
+	if _, err := manager.Store(nil, "", Metadata{Provider: "custom", Message: "buy now"}); !errors.Is(err, ErrBanned) {
+		t.Errorf("expected banned message to be refused, got %v", err)
+	}
+	if _, err := manager.AddBan("", contentHash(nil)); err == nil {
+		t.Error("expected error banning the empty content hash")
+	}
+}
+
+func TestManager_Pin(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 2, 10*1024*1024, nil, logger) // Set max files to 2, 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	// a is the newest file, d the oldest
+	for i, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		modTime := time.Now().Add(time.Duration(-i) * time.Hour)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	if err := manager.SetPinned("d", true); err != nil {
+		t.Fatalf("failed to pin item: %v", err)
+	}
+	if err := manager.SetPinned("missing", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound pinning a missing item, got %v", err)
+	}
+
+	if err := manager.Cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+
+	// The pinned item survives and doesn't count towards the limit
+	for name, want := range map[string]bool{"a": true, "b": true, "c": false, "d": true} {
+		_, err := os.Stat(filepath.Join(tempDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("expected %s to exist: %v, got %v", name, want, exists)
+		}
+	}
+
+	item, _, err := manager.Get("d")
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if !item.Pinned {
+		t.Error("expected item to be pinned")
+	}
+
+	if err := manager.SetPinned("d", false); err != nil {
+		t.Fatalf("failed to unpin item: %v", err)
+	}
+	if err := manager.Cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "d")); !os.IsNotExist(err) {
+		t.Error("expected unpinned item to be evicted")
+	}
+}
+
+func TestManager_Delete(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if err := manager.writeMetadata("a", Metadata{Provider: "xkcd"}); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+
+	if err := manager.Delete("a"); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a")); !os.IsNotExist(err) {
+		t.Error("expected cached file to be removed")
+	}
+	if _, err := os.Stat(manager.metaPath("a")); !os.IsNotExist(err) {
+		t.Error("expected metadata to be removed")
+	}
+
+	if err := manager.Delete("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestManager_SetWindow(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 1, 1024, nil, logger)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	scheduled, err := manager.Store(nil, "", Metadata{Message: "maintenance tonight"})
+	if err != nil {
+		t.Fatalf("failed to store item: %v", err)
+	}
+	live, err := manager.Store(nil, "", Metadata{Message: "hello"})
+	if err != nil {
+		t.Fatalf("failed to store item: %v", err)
+	}
+
+	notBefore := time.Now().Add(time.Hour)
+	if err := manager.SetWindow(scheduled.ID, notBefore, notBefore.Add(-time.Minute)); !errors.Is(err, ErrInvalidWindow) {
+		t.Errorf("expected ErrInvalidWindow, got %v", err)
+	}
+	if err := manager.SetWindow("missing", notBefore, time.Time{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := manager.SetWindow(scheduled.ID, notBefore, time.Time{}); err != nil {
+		t.Fatalf("failed to set window: %v", err)
+	}
+
+	// Scheduled items aren't served yet
+	for range 20 {
+		item, _, err := manager.Select(Query{})
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if item.ID != live.ID {
+			t.Fatalf("selected %s before its window opened", item.ID)
+		}
+	}
+
+	// Nor evicted before they're shown, even though the cache is over its limit
+	if err := manager.Cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	item, _, err := manager.Get(scheduled.ID)
+	if err != nil {
+		t.Fatalf("expected scheduled item to survive cleanup: %v", err)
+	}
+	if !item.NotBefore.Equal(notBefore) || !item.Scheduled(time.Now()) || !item.Live(notBefore) {
+		t.Errorf("unexpected window %v to %v", item.NotBefore, item.NotAfter)
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaDir is the hidden directory holding item metadata sidecars
+const metaDir = ".meta"
+
+// Metadata describes where a cached item came from
+type Metadata struct {
+	Provider  string    `json:"provider,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	Rating    string    `json:"rating,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+	SHA256    string    `json:"sha256,omitempty"` // of the downloaded content
+	Pinned    bool      `json:"pinned,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`      // in addition to Tag, for pushed items
+	NotBefore time.Time `json:"not_before,omitzero"` // when the item is first served
+	NotAfter  time.Time `json:"not_after,omitzero"`  // when the item expires
+
+	// Details recorded by providers that have them, such as XKCD
+	Number     int       `json:"number,omitempty"`
+	Published  time.Time `json:"published,omitzero"`
+	Permalink  string    `json:"permalink,omitempty"`
+	Transcript string    `json:"transcript,omitempty"`
+}
+
+// Item is a cached file together with its metadata
+type Item struct {
+	ID string `json:"id"`
+	Metadata
+}
+
+// HasTag reports whether the item carries the tag, ignoring case
+func (i Item) HasTag(tag string) bool {
+	return strings.EqualFold(tag, i.Tag) || slices.ContainsFunc(i.Tags, func(t string) bool {
+		return strings.EqualFold(tag, t)
+	})
+}
+
+// Contains reports whether the item's title, caption, transcript or tags
+// contain text, ignoring case
+func (i Item) Contains(text string) bool {
+	text = strings.ToLower(text)
+	for _, field := range append([]string{i.Title, i.Message, i.Transcript, i.Tag}, i.Tags...) {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the item's expiry has passed at now
+func (i Item) Expired(now time.Time) bool {
+	return !i.NotAfter.IsZero() && !now.Before(i.NotAfter)
+}
+
+// Scheduled reports whether the item is waiting to be published at now
+func (i Item) Scheduled(now time.Time) bool {
+	return now.Before(i.NotBefore)
+}
+
+// Live reports whether the item may be served at now
+func (i Item) Live(now time.Time) bool {
+	return !i.Scheduled(now) && !i.Expired(now)
+}
+
+// ParseTime parses a publishing window time, either RFC 3339 or a duration
+// relative to now such as "12h"
+func ParseTime(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or a duration", v)
+	}
+	return t, nil
+}
+
+// itemPath returns the path of the cached file for the given item ID
+func (m *Manager) itemPath(id string) string {
+	return filepath.Join(m.cacheDir, id)
+}
+
+// metaPath returns the path of the metadata sidecar for the given item ID
+func (m *Manager) metaPath(id string) string {
+	return filepath.Join(m.cacheDir, metaDir, id+".json")
+}
+
+// writeMetadata stores the metadata sidecar for the given item ID
+func (m *Manager) writeMetadata(id string, meta Metadata) error {
+	dat, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(m.cacheDir, metaDir), 0700); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	if err := os.WriteFile(m.metaPath(id), dat, 0600); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// readItem loads the metadata for the cached file at path. Files cached
+// before metadata was recorded have it derived from their name instead.
+func (m *Manager) readItem(path string) Item {
+	item := Item{ID: filepath.Base(path)}
+
+	dat, err := os.ReadFile(m.metaPath(item.ID))
+	if err == nil {
+		if err := json.Unmarshal(dat, &item.Metadata); err == nil {
+			return item
+		}
+		m.logger.Warn("ignoring invalid metadata", "id", item.ID, "error", err)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		m.logger.Warn("failed to read metadata", "id", item.ID, "error", err)
+	}
+
+	item.Metadata = legacyMetadata(item.ID)
+	if item.FetchedAt.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			item.FetchedAt = info.ModTime()
+		}
+	}
+	return item
+}
+
+// legacyMetadata derives metadata from a "<unix nanos>_<base64 url>" file name
+func legacyMetadata(id string) Metadata {
+	var meta Metadata
+
+	nanos, b64url, ok := strings.Cut(id, "_")
+	if !ok {
+		return meta
+	}
+
+	if n, err := strconv.ParseInt(nanos, 10, 64); err == nil {
+		meta.FetchedAt = time.Unix(0, n)
+	}
+	if url, err := b64.StdEncoding.DecodeString(b64url); err == nil {
+		meta.URL = string(url)
+		meta.Provider = inferProvider(meta.URL)
+	}
+	return meta
+}
+
+// inferProvider guesses the provider from a content URL
+func inferProvider(url string) string {
+	switch {
+	case strings.Contains(url, "giphy.com"):
+		return "giphy"
+	case strings.Contains(url, "xkcd.com"):
+		return "xkcd"
+	}
+	return ""
+}
+
+// ErrNotFound is returned when a requested item isn't in the cache
+var ErrNotFound = errors.New("item not found")
+
+// ErrTooLarge is returned when asked to store content over the size limit
+var ErrTooLarge = errors.New("content too large")
+
+// Items returns every cached item, oldest first
+func (m *Manager) Items() ([]Item, error) {
+	files, err := m.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, len(files))
+	for i, path := range files {
+		items[i] = m.readItem(path)
+	}
+	slices.SortFunc(items, func(a, b Item) int {
+		return a.FetchedAt.Compare(b.FetchedAt)
+	})
+	return items, nil
+}
+
+// Get returns a cached item and its content by ID
+func (m *Manager) Get(id string) (Item, []byte, error) {
+	// IDs name files directly in the cache directory, never hidden state
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return Item{}, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	path := m.itemPath(id)
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Item{}, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Item{}, nil, fmt.Errorf("failed to read cached file: %w", err)
+	}
+
+	return m.readItem(path), dat, nil
+}
@@ -2,16 +2,14 @@ package cache
 
 import (
 	"bytes"
-	"crypto/rand"
 	b64 "encoding/base64"
 	"fmt"
 	"io"
 	"log/slog"
-	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
-	"slices"
+	"strings"
 	"time"
 )
 
@@ -24,34 +22,60 @@ const (
 	CacheFileFormatWithMessage = "%s;File=inline=1;size=%d;name=%s:%s%s\n"
 )
 
+// maxStoredNameLen caps the encoded upload name in an item ID, keeping the
+// file name well under filesystem limits
+const maxStoredNameLen = 64
+
 // Manager handles all cache-related operations
 type Manager struct {
 	cacheDir    string
 	maxFiles    int
 	maxFileSize int64
+	client      *http.Client
 	logger      *slog.Logger
 }
 
-// NewManager creates a new cache manager
-func NewManager(cacheDir string, maxFiles int, maxFileSize int64, logger *slog.Logger) (*Manager, error) {
+// NewManager creates a new cache manager downloading content with client,
+// or http.DefaultClient if it is nil
+func NewManager(cacheDir string, maxFiles int, maxFileSize int64, client *http.Client, logger *slog.Logger) (*Manager, error) {
 	// Ensure cache directory exists
 	if err := os.MkdirAll(cacheDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
+	if client == nil {
+		client = http.DefaultClient
+	}
+
 	return &Manager{
 		cacheDir:    cacheDir,
 		maxFiles:    maxFiles,
 		maxFileSize: maxFileSize,
+		client:      client,
 		logger:      logger,
 	}, nil
 }
 
 // WriteToCache downloads content from the specified URL and saves it into the local cache directory
 func (m *Manager) WriteToCache(url string, msg string) error {
-	m.logger.Info("caching content", "url", url, "message", msg)
+	return m.WriteItem(url, Metadata{Message: msg})
+}
 
-	resp, err := http.Get(url)
+// WriteItem downloads content from the specified URL and saves it into the
+// local cache directory along with its metadata
+func (m *Manager) WriteItem(url string, meta Metadata) error {
+	msg := meta.Message
+	m.logger.Info("caching content", "url", url, "provider", meta.Provider, "tag", meta.Tag, "message", msg)
+
+	bans, err := m.Bans()
+	if err != nil {
+		return err
+	}
+	if bans.banned(url, "") {
+		return fmt.Errorf("%w: %s", ErrBanned, url)
+	}
+
+	resp, err := m.client.Get(url)
 	if err != nil {
 		return fmt.Errorf("failed to download content: %w", err)
 	}
@@ -63,28 +87,99 @@ func (m *Manager) WriteToCache(url string, msg string) error {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
 
+	meta.URL = url
 	b64url := b64.StdEncoding.EncodeToString([]byte(url))
-	cacheFile := filepath.Join(m.cacheDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), b64url))
+	_, err = m.store(buf.Bytes(), b64url, b64url, true, meta, bans)
+	return err
+}
 
-	f, err := os.Create(cacheFile)
+// Store saves caller supplied content into the cache. Content with a name
+// is cached as an inline image captioned with the message; without one the
+// message alone is cached as text.
+func (m *Manager) Store(data []byte, name string, meta Metadata) (Item, error) {
+	if len(data) == 0 && meta.Message == "" {
+		return Item{}, fmt.Errorf("nothing to store")
+	}
+	if !meta.NotBefore.IsZero() && !meta.NotAfter.IsZero() && !meta.NotBefore.Before(meta.NotAfter) {
+		return Item{}, fmt.Errorf("%w: not_before must be before not_after", ErrInvalidWindow)
+	}
+	if m.maxFileSize > 0 && int64(len(data)) > m.maxFileSize {
+		return Item{}, fmt.Errorf("%w: %d bytes, limit is %d", ErrTooLarge, len(data), m.maxFileSize)
+	}
+
+	bans, err := m.Bans()
 	if err != nil {
-		return fmt.Errorf("failed to create cache file: %w", err)
+		return Item{}, err
 	}
-	defer f.Close()
 
-	encoded := b64.StdEncoding.EncodeToString(buf.Bytes())
-	content := m.formatCacheContent(buf.Len(), b64url, encoded, msg)
+	if name == "" {
+		name = meta.Provider
+	}
+	m.logger.Info("storing content", "name", name, "provider", meta.Provider, "tags", meta.Tags, "message", meta.Message)
+	return m.store(data, b64.StdEncoding.EncodeToString([]byte(name)), storedName(name), len(data) > 0, meta, bans)
+}
+
+// storedName encodes a client supplied name for use in an item ID. URL-safe
+// base64 never contains a path separator, and long names are truncated.
+func storedName(name string) string {
+	encoded := b64.RawURLEncoding.EncodeToString([]byte(name))
+	if len(encoded) > maxStoredNameLen {
+		encoded = encoded[:maxStoredNameLen]
+	}
+	return encoded
+}
+
+// store writes content and its metadata to a new cache file, as an inline
+// image named b64name or as the message alone. The item ID ends in idName.
+// Images are hashed by their data and text items by their message.
+func (m *Manager) store(data []byte, b64name, idName string, inline bool, meta Metadata, bans Bans) (Item, error) {
+	content := meta.Message + "\n"
+	hash := contentHash([]byte(content))
+	if inline {
+		hash = contentHash(data)
+	}
+	if bans.banned("", hash) {
+		return Item{}, fmt.Errorf("%w: %s has hash %s", ErrBanned, meta.URL, hash)
+	}
+
+	now := time.Now()
+	id := fmt.Sprintf("%d_%s", now.UnixNano(), idName)
+	cacheFile := filepath.Join(m.cacheDir, id)
 
+	// Write the content to a hidden file and only move it into place once its
+	// metadata exists, so it is never selected without its publishing window
+	f, err := os.CreateTemp(m.cacheDir, ".store-*")
+	if err != nil {
+		return Item{}, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if inline {
+		encoded := b64.StdEncoding.EncodeToString(data)
+		content = m.formatCacheContent(len(data), b64name, encoded, meta.Message)
+	}
 	if _, err := f.WriteString(content); err != nil {
-		return fmt.Errorf("failed to write to cache file: %w", err)
+		return Item{}, fmt.Errorf("failed to write to cache file: %w", err)
 	}
 
 	if err := f.Sync(); err != nil {
-		return fmt.Errorf("failed to sync cache file: %w", err)
+		return Item{}, fmt.Errorf("failed to sync cache file: %w", err)
 	}
 
-	m.logger.Debug("successfully cached content", "file", cacheFile, "size", buf.Len())
-	return nil
+	meta.FetchedAt = now
+	meta.SHA256 = hash
+	if err := m.writeMetadata(id, meta); err != nil {
+		return Item{}, err
+	}
+
+	if err := os.Rename(f.Name(), cacheFile); err != nil {
+		os.Remove(m.metaPath(id))
+		return Item{}, fmt.Errorf("failed to move cache file into place: %w", err)
+	}
+
+	m.logger.Debug("successfully cached content", "file", cacheFile, "size", len(data))
+	return Item{ID: id, Metadata: meta}, nil
 }
 
 // formatCacheContent formats the cache content with optional message
@@ -97,12 +192,25 @@ func (m *Manager) formatCacheContent(size int, b64url, encoded, msg string) stri
 
 // GetRandomFile returns a random file from the cache directory
 func (m *Manager) GetRandomFile() ([]byte, error) {
+	_, dat, err := m.Select(Query{})
+	return dat, err
+}
+
+// listFiles returns the paths of all cached files. Hidden files and
+// directories are skipped so state can be kept alongside the cache.
+func (m *Manager) listFiles() ([]string, error) {
 	var files []string
 
 	err := filepath.Walk(m.cacheDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("error walking path %s: %w", path, err)
 		}
+		if path != m.cacheDir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if info.IsDir() {
 			return nil
 		}
@@ -114,58 +222,11 @@ func (m *Manager) GetRandomFile() ([]byte, error) {
 		return nil, fmt.Errorf("failed to walk cache directory: %w", err)
 	}
 
-	if len(files) == 0 {
-		return nil, fmt.Errorf("no cached files found")
-	}
-
-	// Select random file using cryptographically secure random number generation
-	randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(files))))
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate random index: %w", err)
-	}
-	randFile := files[randIndex.Int64()]
-	dat, err := os.ReadFile(randFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read cached file: %w", err)
-	}
-
-	return dat, nil
+	return files, nil
 }
 
 // Cleanup ensures the cache directory does not exceed the maximum allowed number of files
 func (m *Manager) Cleanup() error {
-	entries, err := os.ReadDir(m.cacheDir)
-	if err != nil {
-		return fmt.Errorf("failed to read cache directory: %w", err)
-	}
-
-	if len(entries) < m.maxFiles {
-		return nil
-	}
-
-	// Sort entries by modification time (oldest first)
-	slices.SortFunc(entries, func(a, b os.DirEntry) int {
-		infoA, errA := a.Info()
-		infoB, errB := b.Info()
-		if errA != nil || errB != nil {
-			return 0
-		}
-		if infoA.ModTime().Before(infoB.ModTime()) {
-			return -1
-		}
-		if infoA.ModTime().After(infoB.ModTime()) {
-			return 1
-		}
-		return 0
-	})
-
-	// Delete oldest files while keeping the newest of the defined max cached files
-	for _, entry := range entries[:len(entries)-m.maxFiles] {
-		filePath := filepath.Join(m.cacheDir, entry.Name())
-		if err := os.Remove(filePath); err != nil {
-			m.logger.Error("failed to remove old cache file", "file", filePath, "error", err)
-		}
-	}
-
-	return nil
+	_, err := m.Prune(PruneOptions{MaxFiles: m.maxFiles})
+	return err
 }
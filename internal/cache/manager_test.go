@@ -2,11 +2,17 @@ package cache
 
 import (
 	"bytes"
+	b64 "encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -35,7 +41,7 @@ func TestNewManager(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-			manager, err := NewManager(tt.cacheDir, tt.maxFiles, 10*1024*1024, logger) // 10MB default
+			manager, err := NewManager(tt.cacheDir, tt.maxFiles, 10*1024*1024, nil, logger) // 10MB default
 
 			if tt.expectErr && err == nil {
 				t.Error("expected error but got none")
@@ -53,7 +59,7 @@ func TestNewManager(t *testing.T) {
 func TestManager_WriteToCache(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	manager, err := NewManager(tempDir, 50, 10*1024*1024, logger) // 10MB default
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
 	if err != nil {
 		t.Fatalf("failed to create manager: %v", err)
 	}
@@ -112,7 +118,7 @@ func TestManager_WriteToCache(t *testing.T) {
 func TestManager_GetRandomFile(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	manager, err := NewManager(tempDir, 50, 10*1024*1024, logger) // 10MB default
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
 	if err != nil {
 		t.Fatalf("failed to create manager: %v", err)
 	}
@@ -179,7 +185,7 @@ func TestManager_GetRandomFile(t *testing.T) {
 func TestManager_Cleanup(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	manager, err := NewManager(tempDir, 3, 10*1024*1024, logger) // Set max files to 3, 10MB default
+	manager, err := NewManager(tempDir, 3, 10*1024*1024, nil, logger) // Set max files to 3, 10MB default
 	if err != nil {
 		t.Fatalf("failed to create manager: %v", err)
 	}
@@ -250,7 +256,7 @@ func TestManager_Cleanup(t *testing.T) {
 func TestManager_CacheFileFormat(t *testing.T) {
 	tempDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	manager, err := NewManager(tempDir, 50, 10*1024*1024, logger) // 10MB default
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
 	if err != nil {
 		t.Fatalf("failed to create manager: %v", err)
 	}
@@ -261,11 +267,12 @@ func TestManager_CacheFileFormat(t *testing.T) {
 		t.Fatalf("failed to write to cache: %v", err)
 	}
 
-	// Find the cache file
+	// Find the cache file, skipping the hidden metadata directory
 	entries, err := os.ReadDir(tempDir)
 	if err != nil {
 		t.Fatalf("failed to read cache directory: %v", err)
 	}
+	entries = slices.DeleteFunc(entries, func(e os.DirEntry) bool { return e.IsDir() })
 	if len(entries) == 0 {
 		t.Fatal("no cache file created")
 	}
@@ -286,3 +293,598 @@ func TestManager_CacheFileFormat(t *testing.T) {
 		t.Error("cache file content does not contain the expected message")
 	}
 }
+
+func TestManager_Select_Exclude(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	for _, name := range []string{"a", "b", ".history.json"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		item, data, err := manager.Select(Query{Exclude: map[string]bool{"a": true}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if item.ID != "b" || string(data) != "b" {
+			t.Errorf("expected only b to be selectable, got %s", item.ID)
+		}
+	}
+
+	// Excluding everything falls back to the full set
+	item, _, err := manager.Select(Query{Exclude: map[string]bool{"a": true, "b": true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.ID != "a" && item.ID != "b" {
+		t.Errorf("expected fallback to a cached file, got %s", item.ID)
+	}
+}
+
+func TestManager_WriteItem_Metadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer srv.Close()
+
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	if err := manager.WriteItem(srv.URL+"/cat.gif", Metadata{Provider: "giphy", Tag: "cats"}); err != nil {
+		t.Fatalf("failed to write item: %v", err)
+	}
+
+	item, data, err := manager.Select(Query{})
+	if err != nil {
+		t.Fatalf("failed to select item: %v", err)
+	}
+	if item.Provider != "giphy" || item.Tag != "cats" {
+		t.Errorf("expected giphy/cats metadata, got %+v", item.Metadata)
+	}
+	if item.URL != srv.URL+"/cat.gif" {
+		t.Errorf("expected URL to be recorded, got %s", item.URL)
+	}
+	if item.FetchedAt.IsZero() {
+		t.Error("expected fetch time to be recorded")
+	}
+	if !bytes.HasPrefix(data, []byte(CacheFilePrefix)) {
+		t.Error("expected cached content to be returned")
+	}
+}
+
+// roundTripFunc lets a function stand in for an HTTP transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestManager_WriteItem_Client(t *testing.T) {
+	var requested string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("image")), Request: req}, nil
+	})}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(t.TempDir(), 50, 10*1024*1024, client, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	if err := manager.WriteItem("https://media.giphy.invalid/cat.gif", Metadata{Provider: "giphy"}); err != nil {
+		t.Fatalf("failed to write item: %v", err)
+	}
+	if requested != "https://media.giphy.invalid/cat.gif" {
+		t.Errorf("expected download through the injected client, got %q", requested)
+	}
+}
+
+func TestLegacyMetadata(t *testing.T) {
+	url := "https://media.giphy.com/media/abc/giphy.gif"
+	id := fmt.Sprintf("%d_%s", int64(1700000000000000000), b64.StdEncoding.EncodeToString([]byte(url)))
+
+	meta := legacyMetadata(id)
+	if meta.URL != url {
+		t.Errorf("expected URL %s, got %s", url, meta.URL)
+	}
+	if meta.Provider != "giphy" {
+		t.Errorf("expected provider giphy, got %s", meta.Provider)
+	}
+	if meta.FetchedAt.UnixNano() != 1700000000000000000 {
+		t.Errorf("unexpected fetch time %v", meta.FetchedAt)
+	}
+}
+
+func TestPickWeighted(t *testing.T) {
+	now := time.Now()
+	items := []Item{
+		{ID: "g1", Metadata: Metadata{Provider: "giphy", Tag: "cats", FetchedAt: now}},
+		{ID: "g2", Metadata: Metadata{Provider: "giphy", Tag: "dogs", FetchedAt: now}},
+		{ID: "x1", Metadata: Metadata{Provider: "xkcd", FetchedAt: now}},
+	}
+
+	tests := []struct {
+		name    string
+		weights Weights
+		allowed map[string]bool
+	}{
+		{
+			name:    "uniform without groups",
+			weights: Weights{},
+			allowed: map[string]bool{"g1": true, "g2": true, "x1": true},
+		},
+		{
+			name:    "provider share",
+			weights: Weights{Groups: map[string]float64{"giphy": 0, "xkcd": 1}},
+			allowed: map[string]bool{"x1": true},
+		},
+		{
+			name:    "provider and tag share",
+			weights: Weights{Groups: map[string]float64{"giphy/dogs": 1, "*": 0}},
+			allowed: map[string]bool{"g2": true},
+		},
+		{
+			name:    "unlisted groups default to 1",
+			weights: Weights{Groups: map[string]float64{"giphy": 0}},
+			allowed: map[string]bool{"x1": true},
+		},
+		{
+			name:    "groups without items are ignored",
+			weights: Weights{Groups: map[string]float64{"custom": 1}},
+			allowed: map[string]bool{"g1": true, "g2": true, "x1": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				item, err := pickWeighted(items, tt.weights, now)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !tt.allowed[item.ID] {
+					t.Errorf("unexpected item %s selected", item.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestWeights_ItemWeight(t *testing.T) {
+	now := time.Now()
+	weights := Weights{FreshnessBoost: 3, FreshnessWindow: time.Hour}
+
+	fresh := Item{Metadata: Metadata{FetchedAt: now.Add(-time.Minute)}}
+	stale := Item{Metadata: Metadata{FetchedAt: now.Add(-2 * time.Hour)}}
+
+	if w := weights.itemWeight(fresh, now); w != 3 {
+		t.Errorf("expected fresh item weight 3, got %v", w)
+	}
+	if w := weights.itemWeight(stale, now); w != 1 {
+		t.Errorf("expected stale item weight 1, got %v", w)
+	}
+}
+
+func TestScope_Matches(t *testing.T) {
+	item := Item{Metadata: Metadata{Provider: "giphy", Tag: "cats", Tags: []string{"cats", "pets"}}}
+
+	tests := []struct {
+		name     string
+		scope    Scope
+		expected bool
+	}{
+		{name: "empty scope", scope: Scope{}, expected: true},
+		{name: "matching tag", scope: Scope{Tags: []string{"dogs", "Cats"}}, expected: true},
+		{name: "other tag", scope: Scope{Tags: []string{"dogs"}}, expected: false},
+		{name: "matching extra tag", scope: Scope{Tags: []string{"Pets"}}, expected: true},
+		{name: "matching source", scope: Scope{Sources: []string{"giphy"}}, expected: true},
+		{name: "tag and other source", scope: Scope{Tags: []string{"cats"}, Sources: []string{"xkcd"}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Matches(item); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestManager_Select_ScopeFallback(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	for id, meta := range map[string]Metadata{
+		"a": {Provider: "giphy", Tag: "cats"},
+		"b": {Provider: "xkcd"},
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, id), []byte(id), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		if err := manager.writeMetadata(id, meta); err != nil {
+			t.Fatalf("failed to write metadata: %v", err)
+		}
+	}
+
+	item, _, err := manager.Select(Query{Scope: Scope{Sources: []string{"xkcd"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.ID != "b" {
+		t.Errorf("expected xkcd item, got %s", item.ID)
+	}
+
+	// An empty subset falls back to any item
+	item, _, err = manager.Select(Query{Scope: Scope{Tags: []string{"dogs"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.ID != "a" && item.ID != "b" {
+		t.Errorf("expected fallback to a cached item, got %s", item.ID)
+	}
+}
+
+func TestStricterRating(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{a: "", b: "", want: ""},
+		{a: "g", b: "", want: "g"},
+		{a: "", b: "pg", want: "pg"},
+		{a: "pg-13", b: "g", want: "g"},
+		{a: "Y", b: "r", want: "Y"},
+		{a: "nsfw", b: "g", want: "g"},
+		{a: "pg", b: "nsfw", want: "pg"},
+	}
+
+	for _, tt := range tests {
+		if got := StricterRating(tt.a, tt.b); got != tt.want {
+			t.Errorf("StricterRating(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		item     Item
+		expected bool
+	}{
+		{
+			name:     "empty policy",
+			policy:   Policy{},
+			item:     Item{Metadata: Metadata{Provider: "giphy", Rating: "r"}},
+			expected: true,
+		},
+		{
+			name:     "rating within ceiling",
+			policy:   Policy{MaxRating: "pg"},
+			item:     Item{Metadata: Metadata{Provider: "giphy", Rating: "g"}},
+			expected: true,
+		},
+		{
+			name:     "rating above ceiling",
+			policy:   Policy{MaxRating: "g"},
+			item:     Item{Metadata: Metadata{Provider: "giphy", Rating: "pg-13"}},
+			expected: false,
+		},
+		{
+			name:     "unrated giphy item",
+			policy:   Policy{MaxRating: "pg-13"},
+			item:     Item{Metadata: Metadata{Provider: "giphy"}},
+			expected: false,
+		},
+		{
+			name:     "unknown rating",
+			policy:   Policy{MaxRating: "g"},
+			item:     Item{Metadata: Metadata{Provider: "custom", Rating: "nsfw"}},
+			expected: false,
+		},
+		{
+			name:     "unknown rating under r ceiling",
+			policy:   Policy{MaxRating: "r"},
+			item:     Item{Metadata: Metadata{Provider: "custom", Rating: "nsfw"}},
+			expected: true,
+		},
+		{
+			name:     "unrated provider",
+			policy:   Policy{MaxRating: "g"},
+			item:     Item{Metadata: Metadata{Provider: "xkcd"}},
+			expected: true,
+		},
+		{
+			name:     "source not allowed",
+			policy:   Policy{Scope: Scope{Sources: []string{"xkcd"}}},
+			item:     Item{Metadata: Metadata{Provider: "giphy", Rating: "g"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.item); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestManager_Select_Policy(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if err := manager.writeMetadata("a", Metadata{Provider: "giphy", Rating: "r"}); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+
+	// Unlike a scope, a policy never falls back to disallowed items
+	if _, _, err := manager.Select(Query{Policy: Policy{MaxRating: "g"}}); err == nil {
+		t.Error("expected error when no item is allowed by policy")
+	}
+}
+
+func TestManager_Get(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "a"), []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if err := manager.writeMetadata("a", Metadata{Provider: "xkcd"}); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		wantNotFound bool
+	}{
+		{name: "cached item", id: "a"},
+		{name: "missing item", id: "b", wantNotFound: true},
+		{name: "hidden state", id: ".meta", wantNotFound: true},
+		{name: "path traversal", id: "../a", wantNotFound: true},
+		{name: "empty id", id: "", wantNotFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, data, err := manager.Get(tt.id)
+			if tt.wantNotFound {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item.ID != "a" || item.Provider != "xkcd" || string(data) != "content" {
+				t.Errorf("unexpected item %+v with content %q", item, data)
+			}
+		})
+	}
+}
+
+func TestManager_Prune(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name        string
+		opts        PruneOptions
+		wantRemoved []string
+		wantKept    int
+	}{
+		{name: "no limits", wantKept: 4},
+		{name: "max files", opts: PruneOptions{MaxFiles: 2}, wantRemoved: []string{"d", "c"}, wantKept: 2},
+		{name: "max age", opts: PruneOptions{MaxAge: 150 * time.Minute}, wantRemoved: []string{"d"}, wantKept: 3},
+		{name: "both", opts: PruneOptions{MaxFiles: 3, MaxAge: 90 * time.Minute}, wantRemoved: []string{"d", "c"}, wantKept: 2},
+		{name: "dry run", opts: PruneOptions{MaxFiles: 1, DryRun: true}, wantRemoved: []string{"d", "c", "b"}, wantKept: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+			if err != nil {
+				t.Fatalf("failed to create manager: %v", err)
+			}
+
+			// a is the newest file, d the oldest
+			for i, name := range []string{"a", "b", "c", "d"} {
+				path := filepath.Join(tempDir, name)
+				if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+					t.Fatalf("failed to create test file: %v", err)
+				}
+				modTime := time.Now().Add(time.Duration(-i) * time.Hour)
+				os.Chtimes(path, modTime, modTime)
+			}
+
+			removed, err := manager.Prune(tt.opts)
+			if err != nil {
+				t.Fatalf("prune failed: %v", err)
+			}
+			if !slices.Equal(removed, tt.wantRemoved) {
+				t.Errorf("expected %v removed, got %v", tt.wantRemoved, removed)
+			}
+
+			items, err := manager.Items()
+			if err != nil {
+				t.Fatalf("failed to list items: %v", err)
+			}
+			if len(items) != tt.wantKept {
+				t.Errorf("expected %d items kept, got %d", tt.wantKept, len(items))
+			}
+		})
+	}
+}
+
+func TestManager_Stats(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 10*1024*1024, nil, logger) // 10MB default
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	stats, err := manager.Stats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Items != 0 || !stats.Oldest.IsZero() {
+		t.Errorf("expected empty stats, got %+v", stats)
+	}
+
+	for id, meta := range map[string]Metadata{
+		"a": {Provider: "xkcd", FetchedAt: time.Unix(100, 0)},
+		"b": {Provider: "giphy", FetchedAt: time.Unix(300, 0)},
+		"c": {Provider: "giphy", FetchedAt: time.Unix(200, 0)},
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, id), []byte("1234"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		if err := manager.writeMetadata(id, meta); err != nil {
+			t.Fatalf("failed to write metadata: %v", err)
+		}
+	}
+
+	stats, err = manager.Stats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Items != 3 || stats.TotalBytes != 12 {
+		t.Errorf("expected 3 items of 12 bytes, got %+v", stats)
+	}
+	if stats.ByProvider["giphy"] != 2 || stats.ByProvider["xkcd"] != 1 {
+		t.Errorf("unexpected provider counts %v", stats.ByProvider)
+	}
+	if !stats.Oldest.Equal(time.Unix(100, 0)) || !stats.Newest.Equal(time.Unix(300, 0)) {
+		t.Errorf("unexpected oldest %v and newest %v", stats.Oldest, stats.Newest)
+	}
+}
+
+func TestManager_Store(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 8, nil, logger)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	text, err := manager.Store(nil, "", Metadata{Provider: "custom", Message: "on-call: alice", Tags: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("failed to store text: %v", err)
+	}
+	if _, dat, err := manager.Get(text.ID); err != nil || string(dat) != "on-call: alice\n" {
+		t.Errorf("expected text content, got %q (%v)", dat, err)
+	}
+
+	image, err := manager.Store([]byte("GIF89a"), "banner.gif", Metadata{Provider: "custom", Message: "shipped"})
+	if err != nil {
+		t.Fatalf("failed to store image: %v", err)
+	}
+	_, dat, err := manager.Get(image.ID)
+	if err != nil {
+		t.Fatalf("failed to get image: %v", err)
+	}
+	encoded := b64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	if !bytes.HasPrefix(dat, []byte(CacheFilePrefix)) || !bytes.Contains(dat, []byte(encoded+"shipped\n")) {
+		t.Errorf("expected inline image content, got %q", dat)
+	}
+	if image.SHA256 == "" || image.FetchedAt.IsZero() {
+		t.Errorf("expected hash and fetch time, got %+v", image.Metadata)
+	}
+
+	for _, name := range []string{"ok?.png", strings.Repeat("long name ", 50) + ".gif"} {
+		item, err := manager.Store([]byte("GIF89a"), name, Metadata{Provider: "custom"})
+		if err != nil {
+			t.Fatalf("failed to store %q: %v", name, err)
+		}
+		if strings.Contains(item.ID, "/") || len(item.ID) > 100 {
+			t.Errorf("unsafe ID %q for %q", item.ID, name)
+		}
+		if _, _, err := manager.Get(item.ID); err != nil {
+			t.Errorf("failed to get %q: %v", name, err)
+		}
+	}
+
+	if leftovers, _ := filepath.Glob(filepath.Join(tempDir, ".store-*")); len(leftovers) > 0 {
+		t.Errorf("expected temporary files to be moved into place, found %v", leftovers)
+	}
+
+	if _, err := manager.Store([]byte("too large for the limit"), "big.gif", Metadata{}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := manager.Store(nil, "", Metadata{}); err == nil {
+		t.Error("expected error storing nothing")
+	}
+	if _, err := manager.AddBan("", image.SHA256); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if _, err := manager.Store([]byte("GIF89a"), "again.gif", Metadata{}); !errors.Is(err, ErrBanned) {
+		t.Errorf("expected ErrBanned, got %v", err)
+	}
+}
+
+func TestManager_Expiry(t *testing.T) {
+	tempDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(tempDir, 50, 1024, nil, logger)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	expired, err := manager.Store(nil, "", Metadata{Message: "old news", NotAfter: time.Now().Add(-time.Minute), Pinned: true})
+	if err != nil {
+		t.Fatalf("failed to store item: %v", err)
+	}
+	live, err := manager.Store(nil, "", Metadata{Message: "still on", NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("failed to store item: %v", err)
+	}
+
+	for range 20 {
+		item, _, err := manager.Select(Query{})
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if item.ID != live.ID {
+			t.Fatalf("selected %s, expected only the unexpired item", item.ID)
+		}
+	}
+
+	removed, err := manager.Prune(PruneOptions{})
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if !slices.Equal(removed, []string{expired.ID}) {
+		t.Errorf("removed %v, want the expired item even though pinned", removed)
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ratings lists the Giphy content ratings from most to least restrictive
+var ratings = []string{"y", "g", "pg", "pg-13", "r"}
+
+// ValidRating reports whether rating is a known Giphy content rating
+func ValidRating(rating string) bool {
+	return slices.Contains(ratings, strings.ToLower(rating))
+}
+
+// ratingRank returns how permissive a rating is. Unknown ratings rank as
+// "r", the most permissive, so they never slip under a ceiling.
+func ratingRank(rating string) int {
+	if i := slices.Index(ratings, strings.ToLower(rating)); i >= 0 {
+		return i
+	}
+	return len(ratings) - 1
+}
+
+// StricterRating returns the more restrictive of two ratings. An empty
+// rating places no restriction.
+func StricterRating(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" || ratingRank(a) <= ratingRank(b) {
+		return a
+	}
+	return b
+}
+
+// Policy restricts which items may ever be served. Unlike Scope, a policy
+// never falls back to items outside it.
+type Policy struct {
+	Scope
+
+	// MaxRating is the highest content rating allowed, e.g. "g". Items from
+	// providers that don't rate content are always allowed, while Giphy
+	// items without a recorded rating, and unknown ratings, are treated as
+	// rated "r".
+	MaxRating string
+}
+
+// Allows reports whether the item may be served under the policy
+func (p Policy) Allows(item Item) bool {
+	if !p.Scope.Matches(item) {
+		return false
+	}
+	if p.MaxRating == "" {
+		return true
+	}
+
+	rating := item.Rating
+	if rating == "" && item.Provider == "giphy" {
+		rating = "r"
+	}
+	if rating == "" {
+		return true
+	}
+
+	return ratingRank(rating) <= ratingRank(p.MaxRating)
+}
+
+// filterAllowed returns the items allowed by the policy
+func (p Policy) filterAllowed(items []Item) ([]Item, error) {
+	if p.Scope.IsEmpty() && p.MaxRating == "" {
+		return items, nil
+	}
+
+	allowed := slices.DeleteFunc(slices.Clone(items), func(item Item) bool {
+		return !p.Allows(item)
+	})
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("no cached files allowed by policy")
+	}
+	return allowed, nil
+}
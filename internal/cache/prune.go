@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PruneOptions controls which cached files Prune removes
+type PruneOptions struct {
+	// MaxFiles keeps only the newest files once there are more than this
+	// many. Zero disables the limit.
+	MaxFiles int
+	// MaxAge removes files modified longer ago than this. Zero disables it.
+	MaxAge time.Duration
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+}
+
+// Prune removes expired and old cached files and their metadata, returning
+// the IDs of the files removed. Pinned items and items scheduled for later
+// are only removed once expired and don't count towards MaxFiles.
+func (m *Manager) Prune(opts PruneOptions) ([]string, error) {
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	// Hidden entries hold server state rather than cached content
+	entries = slices.DeleteFunc(entries, func(e os.DirEntry) bool {
+		return e.IsDir() || strings.HasPrefix(e.Name(), ".")
+	})
+
+	type file struct {
+		id      string
+		modTime time.Time
+	}
+	now := time.Now()
+	var remove []string
+	files := make([]file, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		item := m.readItem(m.itemPath(entry.Name()))
+		if item.Expired(now) {
+			remove = append(remove, item.ID)
+			continue
+		}
+		if item.Pinned || item.Scheduled(now) {
+			continue
+		}
+		files = append(files, file{id: entry.Name(), modTime: info.ModTime()})
+	}
+
+	// Sort files by modification time (oldest first)
+	slices.SortFunc(files, func(a, b file) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	if opts.MaxFiles > 0 && len(files) > opts.MaxFiles {
+		for _, f := range files[:len(files)-opts.MaxFiles] {
+			remove = append(remove, f.id)
+		}
+		files = files[len(files)-opts.MaxFiles:]
+	}
+	if opts.MaxAge > 0 {
+		cutoff := now.Add(-opts.MaxAge)
+		for _, f := range files {
+			if f.modTime.Before(cutoff) {
+				remove = append(remove, f.id)
+			}
+		}
+	}
+
+	if opts.DryRun {
+		return remove, nil
+	}
+
+	removed := remove[:0]
+	for _, id := range remove {
+		if err := m.removeItem(id); err != nil {
+			m.logger.Error("failed to remove old cache file", "id", id, "error", err)
+			continue
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
+
+// removeItem deletes a cached file and its metadata sidecar
+func (m *Manager) removeItem(id string) error {
+	if err := os.Remove(m.itemPath(id)); err != nil {
+		return fmt.Errorf("failed to remove cache file: %w", err)
+	}
+	if err := os.Remove(m.metaPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logger.Error("failed to remove cache metadata", "file", filepath.Join(m.cacheDir, id), "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Query narrows and weights the set of cached files considered by Select
+type Query struct {
+	// Exclude holds IDs of files that should not be selected, such as the
+	// ones a client has seen recently. It is ignored if it would exclude
+	// every cached file, so a small cache still serves something.
+	Exclude map[string]bool
+
+	// Policy restricts selection to the items a listener may serve
+	Policy Policy
+
+	// Scope restricts selection to items with one of the given tags or
+	// sources. It is ignored if no allowed item matches.
+	Scope Scope
+
+	// Weights biases selection between providers and towards new items
+	Weights Weights
+}
+
+// Scope selects a subset of cached items by tag and source provider
+type Scope struct {
+	Tags    []string
+	Sources []string
+}
+
+// IsEmpty reports whether the scope matches every item
+func (s Scope) IsEmpty() bool {
+	return len(s.Tags) == 0 && len(s.Sources) == 0
+}
+
+// Matches reports whether the item falls within the scope
+func (s Scope) Matches(item Item) bool {
+	if len(s.Tags) > 0 && !slices.ContainsFunc(s.Tags, item.HasTag) {
+		return false
+	}
+	if len(s.Sources) > 0 && !slices.ContainsFunc(s.Sources, func(source string) bool {
+		return strings.EqualFold(source, item.Provider)
+	}) {
+		return false
+	}
+	return true
+}
+
+// Weights controls how likely each cached item is to be selected
+type Weights struct {
+	// Groups maps a provider ("giphy") or a provider and tag ("giphy/cats")
+	// to its share of selections. The key "*" covers items matching no
+	// other key; without it they share a weight of 1. Without any groups
+	// every item is equally likely.
+	Groups map[string]float64
+
+	// FreshnessBoost multiplies the weight of items fetched within
+	// FreshnessWindow. Values of 1 or less disable the boost.
+	FreshnessBoost  float64
+	FreshnessWindow time.Duration
+}
+
+// Select returns a random cached item matching the query and its content
+func (m *Manager) Select(q Query) (Item, []byte, error) {
+	files, err := m.listFiles()
+	if err != nil {
+		return Item{}, nil, err
+	}
+
+	if len(files) == 0 {
+		return Item{}, nil, fmt.Errorf("no cached files found")
+	}
+
+	now := time.Now()
+	items := make([]Item, 0, len(files))
+	for _, path := range files {
+		if item := m.readItem(path); item.Live(now) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return Item{}, nil, fmt.Errorf("no cached files are currently published")
+	}
+
+	items, err = q.Policy.filterAllowed(items)
+	if err != nil {
+		return Item{}, nil, err
+	}
+
+	scoped := items
+	if !q.Scope.IsEmpty() {
+		scoped = slices.DeleteFunc(slices.Clone(items), func(item Item) bool {
+			return !q.Scope.Matches(item)
+		})
+		if len(scoped) == 0 {
+			m.logger.Debug("no cached items in scope, falling back to all items",
+				"tags", q.Scope.Tags, "sources", q.Scope.Sources)
+			scoped = items
+		}
+	}
+
+	candidates := scoped
+	if len(q.Exclude) > 0 {
+		candidates = slices.DeleteFunc(slices.Clone(scoped), func(item Item) bool {
+			return q.Exclude[item.ID]
+		})
+		if len(candidates) == 0 {
+			candidates = scoped
+		}
+	}
+
+	item, err := pickWeighted(candidates, q.Weights, now)
+	if err != nil {
+		return Item{}, nil, err
+	}
+
+	dat, err := os.ReadFile(m.itemPath(item.ID))
+	if err != nil {
+		return Item{}, nil, fmt.Errorf("failed to read cached file: %w", err)
+	}
+
+	return item, dat, nil
+}
+
+// group returns the Weights.Groups key an item belongs to, or "" if none
+func (w Weights) group(item Item) string {
+	if _, ok := w.Groups[item.Provider+"/"+item.Tag]; ok && item.Tag != "" {
+		return item.Provider + "/" + item.Tag
+	}
+	if _, ok := w.Groups[item.Provider]; ok && item.Provider != "" {
+		return item.Provider
+	}
+	if _, ok := w.Groups["*"]; ok {
+		return "*"
+	}
+	return ""
+}
+
+// share returns a group's share of selections. Items in no group, such as
+// custom pushes while only giphy and xkcd are weighted, default to 1 so
+// they are still served.
+func (w Weights) share(group string) float64 {
+	if weight, ok := w.Groups[group]; ok {
+		return weight
+	}
+	return 1
+}
+
+// itemWeight returns the weight of an item within its group
+func (w Weights) itemWeight(item Item, now time.Time) float64 {
+	if w.FreshnessBoost > 1 && now.Sub(item.FetchedAt) < w.FreshnessWindow {
+		return w.FreshnessBoost
+	}
+	return 1
+}
+
+// pickWeighted selects one of the items according to the weights. Each
+// group receives its configured share of selections, split between its
+// items in proportion to their freshness.
+func pickWeighted(items []Item, w Weights, now time.Time) (Item, error) {
+	groups := make([]string, len(items))
+	groupTotals := make(map[string]float64)
+	for i, item := range items {
+		groups[i] = w.group(item)
+		groupTotals[groups[i]] += w.itemWeight(item, now)
+	}
+
+	// Only count the shares of groups that actually have items
+	var shareTotal float64
+	for group := range groupTotals {
+		shareTotal += w.share(group)
+	}
+
+	weights := make([]float64, len(items))
+	var total float64
+	for i, item := range items {
+		weights[i] = w.itemWeight(item, now)
+		if shareTotal > 0 {
+			weights[i] *= w.share(groups[i]) / shareTotal / groupTotals[groups[i]]
+		}
+		total += weights[i]
+	}
+
+	r, err := randFloat()
+	if err != nil {
+		return Item{}, err
+	}
+
+	target := r * total
+	for i, weight := range weights {
+		if target < weight {
+			return items[i], nil
+		}
+		target -= weight
+	}
+
+	// Floating point rounding can leave target just above the last weight
+	for i := len(items) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return items[i], nil
+		}
+	}
+	return items[len(items)-1], nil
+}
+
+// randFloat returns a cryptographically secure random number in [0, 1)
+func randFloat() (float64, error) {
+	const precision = 1 << 53
+	n, err := rand.Int(rand.Reader, big.NewInt(precision))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate random number: %w", err)
+	}
+	return float64(n.Int64()) / precision, nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Stats summarises the contents of the cache
+type Stats struct {
+	Items      int            `json:"items"`
+	TotalBytes int64          `json:"total_bytes"`
+	ByProvider map[string]int `json:"by_provider"`
+	Oldest     time.Time      `json:"oldest,omitzero"`
+	Newest     time.Time      `json:"newest,omitzero"`
+}
+
+// Stats counts the cached items and their size on disk
+func (m *Manager) Stats() (Stats, error) {
+	items, err := m.Items()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Items:      len(items),
+		ByProvider: make(map[string]int),
+	}
+	for _, item := range items {
+		info, err := os.Stat(m.itemPath(item.ID))
+		if err != nil {
+			return Stats{}, fmt.Errorf("failed to stat cached file: %w", err)
+		}
+		stats.TotalBytes += info.Size()
+
+		provider := item.Provider
+		if provider == "" {
+			provider = "unknown"
+		}
+		stats.ByProvider[provider]++
+	}
+
+	if len(items) > 0 {
+		stats.Oldest = items[0].FetchedAt
+		stats.Newest = items[len(items)-1].FetchedAt
+	}
+	return stats, nil
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// list prints the cached items
+func list(e *env, args []string) error {
+	fs := e.flags("list", "[-json] [-provider name] [-tag name] [-search text]")
+	asJSON := fs.Bool("json", false, "print items as JSON")
+	provider := fs.String("provider", "", "only list items from this provider")
+	tag := fs.String("tag", "", "only list items with this tag")
+	search := fs.String("search", "", "only list items whose title, caption, transcript or tags contain this text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	items, err := cacheManager.Items()
+	if err != nil {
+		return err
+	}
+	items = slices.DeleteFunc(items, func(item cache.Item) bool {
+		return (*provider != "" && !strings.EqualFold(item.Provider, *provider)) ||
+			(*tag != "" && !strings.EqualFold(item.Tag, *tag)) ||
+			(*search != "" && !item.Contains(*search))
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPINNED\tPROVIDER\tTAG\tRATING\tFETCHED\tURL")
+	for _, item := range items {
+		pinned := "-"
+		if item.Pinned {
+			pinned = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			item.ID,
+			pinned,
+			orDash(item.Provider),
+			orDash(item.Tag),
+			orDash(item.Rating),
+			item.FetchedAt.Format(time.DateTime),
+			orDash(item.URL),
+		)
+	}
+	return w.Flush()
+}
+
+// show writes a cached item, or its metadata, to stdout
+func show(e *env, args []string) error {
+	fs := e.flags("show", "[-meta] <id>")
+	meta := fs.Bool("meta", false, "print the item's metadata as JSON instead of its content")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	item, data, err := cacheManager.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *meta {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(item)
+	}
+	_, err = e.stdout.Write(data)
+	return err
+}
+
+// prune removes old items, by default applying the configured limits
+func prune(e *env, args []string) error {
+	fs := e.flags("prune", "[-max-files n] [-max-age duration] [-dry-run]")
+	maxFiles := fs.Int("max-files", -1, "keep at most this many items (default MOTD_CACHE_MAX_FILES)")
+	maxAge := fs.Duration("max-age", 0, "also remove items older than this, e.g. 72h")
+	dryRun := fs.Bool("dry-run", false, "list what would be removed without removing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	opts := cache.PruneOptions{
+		MaxFiles: cfg.CacheMaxFiles,
+		MaxAge:   *maxAge,
+		DryRun:   *dryRun,
+	}
+	if *maxFiles >= 0 {
+		opts.MaxFiles = *maxFiles
+	}
+
+	removed, err := cacheManager.Prune(opts)
+	if err != nil {
+		return err
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	for _, id := range removed {
+		fmt.Fprintf(e.stdout, "%s %s\n", verb, id)
+	}
+	fmt.Fprintf(e.stdout, "%s %d items\n", verb, len(removed))
+	return nil
+}
+
+// stats prints a summary of the cache
+func stats(e *env, args []string) error {
+	fs := e.flags("stats", "[-json]")
+	asJSON := fs.Bool("json", false, "print stats as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	s, err := cacheManager.Stats()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "cache dir:\t%s\n", cfg.CacheDir)
+	fmt.Fprintf(w, "items:\t%d of %d\n", s.Items, cfg.CacheMaxFiles)
+	fmt.Fprintf(w, "size:\t%d bytes\n", s.TotalBytes)
+
+	providers := make([]string, 0, len(s.ByProvider))
+	for provider := range s.ByProvider {
+		providers = append(providers, provider)
+	}
+	slices.Sort(providers)
+	for _, provider := range providers {
+		fmt.Fprintf(w, "  %s:\t%d\n", provider, s.ByProvider[provider])
+	}
+
+	if s.Items > 0 {
+		fmt.Fprintf(w, "oldest:\t%s\n", s.Oldest.Format(time.DateTime))
+		fmt.Fprintf(w, "newest:\t%s\n", s.Newest.Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+// orDash substitutes a dash for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
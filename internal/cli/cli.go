@@ -0,0 +1,258 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/stevielcb/motd-server/app"
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/httpclient"
+	"github.com/stevielcb/motd-server/internal/schedule"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// errUsage reports invalid arguments after usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// command is a motd-server subcommand
+type command struct {
+	summary string
+	run     func(env *env, args []string) error
+}
+
+// env holds what subcommands need from the process
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// commands lists the subcommands by name
+var commands = map[string]command{
+	"serve":    {summary: "serve cached content (default)", run: serve},
+	"fetch":    {summary: "download new content once and exit", run: fetch},
+	"list":     {summary: "list cached items with their metadata", run: list},
+	"show":     {summary: "write a cached item to stdout", run: show},
+	"prune":    {summary: "remove old items from the cache", run: prune},
+	"stats":    {summary: "summarise the cache", run: stats},
+	"pin":      {summary: "keep items from being evicted", run: pin},
+	"schedule": {summary: "set when items are served", run: scheduleItems},
+	"delete":   {summary: "remove items from the cache", run: deleteItems},
+	"ban":      {summary: "delete items and never download them again", run: ban},
+	"doctor":   {summary: "check configuration and permissions", run: doctor},
+}
+
+// Run runs the subcommand named by args and returns the process exit code
+func Run(args []string, version string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+	httpclient.Version = version
+
+	fs := flag.NewFlagSet("motd-server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	showVersion := fs.Bool("version", false, "Show version information")
+	fs.Usage = func() { e.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *showVersion {
+		fmt.Fprintf(stdout, "motd-server version %s\n", version)
+		return 0
+	}
+
+	name, args := "serve", fs.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		e.usage(fs)
+		return 2
+	}
+
+	if err := cmd.run(e, args); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "motd-server %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// usage prints the global flags and subcommands
+func (e *env) usage(fs *flag.FlagSet) {
+	fmt.Fprintf(e.stderr, "Usage: motd-server [-version] [command] [arguments]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(e.stderr, "  %-8s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintf(e.stderr, "\nFlags:\n")
+	fs.PrintDefaults()
+}
+
+// flags returns a flag set for a subcommand that prints errors to stderr
+func (e *env) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: motd-server %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// logger returns a logger for one-shot commands that keeps stdout clean
+// for their output
+func (e *env) logger() *slog.Logger {
+	logger := slog.New(slog.NewTextHandler(e.stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	}))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// openCache loads the configuration and opens the cache it points at
+func (e *env) openCache() (*config.Config, *cache.Manager, *slog.Logger, error) {
+	cfg, cacheManager, _, logger, err := e.openCacheClient()
+	return cfg, cacheManager, logger, err
+}
+
+// openCacheClient is openCache, also returning the outbound HTTP client the
+// cache downloads with so providers can share it
+func (e *env) openCacheClient() (*config.Config, *cache.Manager, *http.Client, *slog.Logger, error) {
+	logger := e.logger()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client, err := httpclient.FromConfig(cfg, logger)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	cacheManager, err := cache.NewManager(cfg.CacheDir, cfg.CacheMaxFiles, cfg.MaxFileSize, client, logger)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return cfg, cacheManager, client, logger, nil
+}
+
+// serve runs the server until interrupted
+func serve(e *env, args []string) error {
+	fs := e.flags("serve", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Initialize structured logger
+	logger := slog.New(slog.NewTextHandler(e.stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create application
+	application, err := app.New(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+
+	// Handle graceful shutdown with context
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Start application; Start blocks while the main server runs
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- application.Start()
+	}()
+
+	// Wait for shutdown signal or the server failing
+	select {
+	case <-ctx.Done():
+		logger.Info("received shutdown signal")
+	case err := <-errChan:
+		if err != nil {
+			return fmt.Errorf("failed to start application: %w", err)
+		}
+	}
+	logger.Info("shutting down application")
+
+	// Stop application gracefully, giving in-flight responses time to finish
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer stopCancel()
+	if err := application.Stop(stopCtx); err != nil {
+		return fmt.Errorf("failed to stop application gracefully: %w", err)
+	}
+
+	logger.Info("application stopped successfully")
+	return nil
+}
+
+// fetch runs a single download pass
+func fetch(e *env, args []string) error {
+	fs := e.flags("fetch", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, cacheManager, client, logger, err := e.openCacheClient()
+	if err != nil {
+		return err
+	}
+
+	sched, err := schedule.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	servicesManager, err := services.NewManager(cfg, sched, client, logger)
+	if err != nil {
+		return err
+	}
+
+	before, err := cacheManager.Items()
+	if err != nil {
+		return err
+	}
+	if err := servicesManager.DownloadMOTDs(cacheManager); err != nil {
+		return err
+	}
+	after, err := cacheManager.Items()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "cached %d new items (%d total)\n", max(len(after)-len(before), 0), len(after))
+	return nil
+}
+
+// fileMode formats a permission mode the way ls does
+func fileMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// setupCache points the configuration at a temporary cache holding one
+// xkcd and one giphy item, returning their IDs oldest first
+func setupCache(t *testing.T) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "giphy-api")
+	if err := os.WriteFile(keyFile, []byte("test-api-key"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0700); err != nil {
+		t.Fatalf("failed to create cache dir: %v", err)
+	}
+
+	t.Setenv("MOTD_CACHE_DIR", cacheDir)
+	t.Setenv("MOTD_GIPHY_API_KEY_FILE", keyFile)
+	t.Setenv("MOTD_GIPHY_TAGS", "cats:g")
+
+	var ids []string
+	for i, url := range []string{"https://imgs.xkcd.com/comics/a.png", "https://media.giphy.com/b.gif"} {
+		fetched := time.Now().Add(time.Duration(i-2) * time.Hour)
+		id := fmt.Sprintf("%d_%s", fetched.UnixNano(), b64.URLEncoding.EncodeToString([]byte(url)))
+		path := filepath.Join(cacheDir, id)
+		if err := os.WriteFile(path, []byte("content "+url), 0600); err != nil {
+			t.Fatalf("failed to write cached file: %v", err)
+		}
+		os.Chtimes(path, fetched, fetched)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// run runs the CLI and returns its exit code and output
+func run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, "test", &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{name: "version", args: []string{"-version"}, wantCode: 0, wantOut: "motd-server version test"},
+		{name: "unknown command", args: []string{"bogus"}, wantCode: 2},
+		{name: "unknown flag", args: []string{"-bogus"}, wantCode: 2},
+		{name: "show without id", args: []string{"show"}, wantCode: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, _ := run(tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, code)
+			}
+			if !strings.Contains(stdout, tt.wantOut) {
+				t.Errorf("expected output to contain %q, got %q", tt.wantOut, stdout)
+			}
+		})
+	}
+}
+
+func TestRun_List(t *testing.T) {
+	ids := setupCache(t)
+
+	code, stdout, stderr := run("list")
+	if code != 0 {
+		t.Fatalf("list failed with code %d: %s", code, stderr)
+	}
+	for _, id := range ids {
+		if !strings.Contains(stdout, id) {
+			t.Errorf("expected list to contain %s, got %s", id, stdout)
+		}
+	}
+
+	code, stdout, stderr = run("list", "-json", "-provider", "giphy")
+	if code != 0 {
+		t.Fatalf("list -json failed with code %d: %s", code, stderr)
+	}
+	var items []cache.Item
+	if err := json.Unmarshal([]byte(stdout), &items); err != nil {
+		t.Fatalf("failed to parse list output: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != ids[1] || items[0].Provider != "giphy" {
+		t.Errorf("expected only the giphy item, got %+v", items)
+	}
+}
+
+func TestRun_Show(t *testing.T) {
+	ids := setupCache(t)
+
+	code, stdout, stderr := run("show", ids[0])
+	if code != 0 {
+		t.Fatalf("show failed with code %d: %s", code, stderr)
+	}
+	if stdout != "content https://imgs.xkcd.com/comics/a.png" {
+		t.Errorf("unexpected content %q", stdout)
+	}
+
+	code, stdout, _ = run("show", "-meta", ids[0])
+	if code != 0 || !strings.Contains(stdout, `"provider": "xkcd"`) {
+		t.Errorf("expected xkcd metadata, got code %d and %s", code, stdout)
+	}
+
+	for _, id := range []string{"missing", "../cache", ".meta"} {
+		if code, _, _ := run("show", id); code != 1 {
+			t.Errorf("expected show %q to fail with code 1, got %d", id, code)
+		}
+	}
+}
+
+func TestRun_Prune(t *testing.T) {
+	ids := setupCache(t)
+
+	code, stdout, stderr := run("prune", "-max-files", "1", "-dry-run")
+	if code != 0 {
+		t.Fatalf("prune failed with code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "would remove "+ids[0]) {
+		t.Errorf("expected dry run to report the oldest item, got %s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("MOTD_CACHE_DIR"), ids[0])); err != nil {
+		t.Errorf("expected dry run to keep the item: %v", err)
+	}
+
+	if code, _, stderr := run("prune", "-max-files", "1"); code != 0 {
+		t.Fatalf("prune failed with code %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("MOTD_CACHE_DIR"), ids[0])); !os.IsNotExist(err) {
+		t.Error("expected oldest item to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("MOTD_CACHE_DIR"), ids[1])); err != nil {
+		t.Errorf("expected newest item to be kept: %v", err)
+	}
+}
+
+func TestRun_Stats(t *testing.T) {
+	setupCache(t)
+
+	code, stdout, stderr := run("stats", "-json")
+	if code != 0 {
+		t.Fatalf("stats failed with code %d: %s", code, stderr)
+	}
+
+	var s cache.Stats
+	if err := json.Unmarshal([]byte(stdout), &s); err != nil {
+		t.Fatalf("failed to parse stats output: %v", err)
+	}
+	if s.Items != 2 || s.ByProvider["xkcd"] != 1 || s.ByProvider["giphy"] != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestRun_Doctor(t *testing.T) {
+	setupCache(t)
+
+	code, stdout, _ := run("doctor")
+	if code != 0 {
+		t.Errorf("expected doctor to pass, got code %d: %s", code, stdout)
+	}
+
+	// Giphy tags from schedule rules count as much as MOTD_GIPHY_TAGS
+	t.Setenv("MOTD_GIPHY_TAGS", "")
+	t.Setenv("MOTD_RULES", `[{"name": "friday", "days": ["fri"], "giphy_tags": {"friday": "g"}}]`)
+	code, stdout, _ = run("doctor")
+	if code != 0 || strings.Contains(stdout, "warn  giphy key file") {
+		t.Errorf("expected giphy key check to pass with rule tags, got code %d: %s", code, stdout)
+	}
+
+	t.Setenv("MOTD_GIPHY_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	code, stdout, _ = run("doctor")
+	if code != 1 {
+		t.Errorf("expected doctor to fail with code 1, got %d", code)
+	}
+	if !strings.Contains(stdout, "FAIL  giphy key file") {
+		t.Errorf("expected key file failure, got %s", stdout)
+	}
+}
+
+func TestRun_DoctorSideEffects(t *testing.T) {
+	setupCache(t)
+	dir := t.TempDir()
+	t.Setenv("MOTD_LISTENERS", fmt.Sprintf(`[
+		{"name": "b", "port": 4201, "tls_cert_file": %[1]q, "tls_key_file": %[1]q},
+		{"name": "a", "port": 4202, "tls_cert_file": %[1]q, "tls_key_file": %[1]q}
+	]`, filepath.Join(dir, "missing")))
+
+	// Doctor must leave activated sockets for the server it's checking
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	t.Setenv("MOTD_ADMIN_PORT", "4280")
+	t.Setenv("MOTD_ADMIN_TOKEN_COMMAND", "echo token")
+
+	_, stdout, _ := run("doctor")
+	if os.Getenv("LISTEN_PID") != "1" || os.Getenv("LISTEN_FDS") != "1" {
+		t.Error("expected doctor to leave the socket activation variables set")
+	}
+
+	a := strings.Index(stdout, "FAIL  tls a")
+	b := strings.Index(stdout, "FAIL  tls b")
+	if a < 0 || b < 0 || a > b {
+		t.Errorf("expected TLS failures sorted by listener, got %s", stdout)
+	}
+	if !strings.Contains(stdout, "ok    admin token: from command") {
+		t.Errorf("expected admin token check, got %s", stdout)
+	}
+}
+
+func TestRun_Curation(t *testing.T) {
+	ids := setupCache(t)
+	cacheDir := os.Getenv("MOTD_CACHE_DIR")
+
+	if code, _, stderr := run("pin", ids[0]); code != 0 {
+		t.Fatalf("pin failed with code %d: %s", code, stderr)
+	}
+	code, stdout, _ := run("show", "-meta", ids[0])
+	if code != 0 || !strings.Contains(stdout, `"pinned": true`) {
+		t.Errorf("expected item to be pinned, got %s", stdout)
+	}
+	if code, _, _ := run("pin", "-remove", ids[0]); code != 0 {
+		t.Errorf("unpin failed with code %d", code)
+	}
+
+	if code, _, stderr := run("schedule", "-not-before", "2030-01-01T00:00:00Z", "-not-after", "2030-01-02T00:00:00Z", ids[0]); code != 0 {
+		t.Fatalf("schedule failed with code %d: %s", code, stderr)
+	}
+	code, stdout, _ = run("show", "-meta", ids[0])
+	if code != 0 || !strings.Contains(stdout, `"not_before": "2030-01-01T00:00:00Z"`) {
+		t.Errorf("expected item to be scheduled, got %s", stdout)
+	}
+	if code, _, _ := run("schedule", "-not-before", "2030-01-02T00:00:00Z", "-not-after", "1h", ids[0]); code != 1 {
+		t.Errorf("expected an inverted window to fail with code 1, got %d", code)
+	}
+
+	if code, _, stderr := run("ban", ids[1]); code != 0 {
+		t.Fatalf("ban failed with code %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, ids[1])); !os.IsNotExist(err) {
+		t.Error("expected banned item to be deleted")
+	}
+	code, stdout, _ = run("ban", "-list")
+	if code != 0 || !strings.Contains(stdout, "https://media.giphy.com/b.gif") {
+		t.Errorf("expected banned URL to be listed, got %s", stdout)
+	}
+
+	if code, _, stderr := run("delete", ids[0]); code != 0 {
+		t.Fatalf("delete failed with code %d: %s", code, stderr)
+	}
+	if code, _, _ := run("delete", ids[0]); code != 1 {
+		t.Errorf("expected deleting a missing item to fail with code 1, got %d", code)
+	}
+	if code, _, _ := run("ban"); code != 2 {
+		t.Errorf("expected ban without arguments to fail with code 2, got %d", code)
+	}
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// pin pins or unpins items so Cleanup never evicts them
+func pin(e *env, args []string) error {
+	fs := e.flags("pin", "[-remove] <id>...")
+	remove := fs.Bool("remove", false, "unpin the items instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	verb := "pinned"
+	if *remove {
+		verb = "unpinned"
+	}
+	for _, id := range fs.Args() {
+		if err := cacheManager.SetPinned(id, !*remove); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "%s %s\n", verb, id)
+	}
+	return nil
+}
+
+// scheduleItems sets the window in which items are served
+func scheduleItems(e *env, args []string) error {
+	fs := e.flags("schedule", "[-not-before time] [-not-after time] <id>...")
+	notBefore := fs.String("not-before", "", "don't serve before this time (RFC 3339 or a duration from now)")
+	notAfter := fs.String("not-after", "", "remove after this time (RFC 3339 or a duration from now)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	now := time.Now()
+	var window [2]time.Time
+	for i, v := range []string{*notBefore, *notAfter} {
+		if v == "" {
+			continue
+		}
+		t, err := cache.ParseTime(v, now)
+		if err != nil {
+			return err
+		}
+		window[i] = t
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range fs.Args() {
+		if err := cacheManager.SetWindow(id, window[0], window[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "scheduled %s from %s until %s\n", id, orDash(formatTime(window[0])), orDash(formatTime(window[1])))
+	}
+	return nil
+}
+
+// formatTime formats a window time, or "" for an open end
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// deleteItems removes individual items from the cache
+func deleteItems(e *env, args []string) error {
+	fs := e.flags("delete", "<id>...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range fs.Args() {
+		if err := cacheManager.Delete(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "deleted %s\n", id)
+	}
+	return nil
+}
+
+// ban deletes items and stops their content being downloaded again
+func ban(e *env, args []string) error {
+	fs := e.flags("ban", "[-url url] [-sha256 hash] [-remove] [-list] [<id>...]")
+	url := fs.String("url", "", "ban a source URL")
+	hash := fs.String("sha256", "", "ban content by its SHA-256 hash")
+	remove := fs.Bool("remove", false, "lift the ban on -url or -sha256 instead")
+	list := fs.Bool("list", false, "print the current bans as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, cacheManager, _, err := e.openCache()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *list:
+		bans, err := cacheManager.Bans()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(bans)
+
+	case *remove:
+		if *url == "" && *hash == "" {
+			fs.Usage()
+			return errUsage
+		}
+		if err := cacheManager.RemoveBan(*url, *hash); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, "ban lifted")
+		return nil
+
+	case *url != "" || *hash != "":
+		deleted, err := cacheManager.AddBan(*url, *hash)
+		if err != nil {
+			return err
+		}
+		e.printBanned(deleted)
+		return nil
+
+	case fs.NArg() > 0:
+		for _, id := range fs.Args() {
+			deleted, err := cacheManager.Ban(id)
+			if err != nil {
+				return err
+			}
+			e.printBanned(deleted)
+		}
+		return nil
+
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
+
+// printBanned reports the items deleted by a ban
+func (e *env) printBanned(deleted []string) {
+	for _, id := range deleted {
+		fmt.Fprintf(e.stdout, "deleted %s\n", id)
+	}
+	fmt.Fprintf(e.stdout, "banned, %d items deleted\n", len(deleted))
+}
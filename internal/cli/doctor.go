@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/stevielcb/motd-server/app"
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// Check outcomes printed by doctor
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "FAIL"
+)
+
+// checker prints check results and counts failures
+type checker struct {
+	e        *env
+	failures int
+}
+
+// report prints the outcome of one check
+func (c *checker) report(status, name, format string, args ...any) {
+	if status == checkFail {
+		c.failures++
+	}
+	fmt.Fprintf(c.e.stdout, "%-4s  %s: %s\n", status, name, fmt.Sprintf(format, args...))
+}
+
+// doctor checks the configuration, files and permissions the server needs
+func doctor(e *env, args []string) error {
+	fs := e.flags("doctor", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger := e.logger()
+	c := &checker{e: e}
+
+	cfg, err := config.Load()
+	if err != nil {
+		c.report(checkFail, "configuration", "%v", err)
+		return fmt.Errorf("%d checks failed", c.failures)
+	}
+	c.report(checkOK, "configuration", "loaded")
+
+	c.checkCacheDir(cfg)
+	c.checkKeyFile(cfg)
+	c.checkAdminToken(cfg)
+	c.checkTLS(cfg)
+
+	if err := app.Validate(cfg, logger); err != nil {
+		c.report(checkFail, "application", "%v", err)
+	} else {
+		c.report(checkOK, "application", "listeners and services are valid")
+	}
+
+	if c.failures > 0 {
+		return fmt.Errorf("%d checks failed", c.failures)
+	}
+	return nil
+}
+
+// checkCacheDir checks the cache directory is a private, writable directory
+func (c *checker) checkCacheDir(cfg *config.Config) {
+	const name = "cache directory"
+
+	info, err := os.Stat(cfg.CacheDir)
+	if err != nil {
+		c.report(checkFail, name, "%v", err)
+		return
+	}
+	if !info.IsDir() {
+		c.report(checkFail, name, "%s is not a directory", cfg.CacheDir)
+		return
+	}
+
+	// Hidden files are ignored by the cache, so the probe can't be served
+	probe, err := os.CreateTemp(cfg.CacheDir, ".doctor-*")
+	if err != nil {
+		c.report(checkFail, name, "%s is not writable: %v", cfg.CacheDir, err)
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if info.Mode().Perm()&0022 != 0 {
+		c.report(checkWarn, name, "%s is writable by other users (mode %s)", cfg.CacheDir, fileMode(info.Mode()))
+		return
+	}
+
+	manager, err := cache.NewManager(cfg.CacheDir, cfg.CacheMaxFiles, cfg.MaxFileSize, nil, c.e.logger())
+	if err != nil {
+		c.report(checkFail, name, "%v", err)
+		return
+	}
+	items, err := manager.Items()
+	if err != nil {
+		c.report(checkFail, name, "%v", err)
+		return
+	}
+	c.report(checkOK, name, "%s (%d items)", cfg.CacheDir, len(items))
+}
+
+// checkKeyFile checks the Giphy API key can be read and, when it comes
+// from a file, that the file is private
+func (c *checker) checkKeyFile(cfg *config.Config) {
+	const name = "giphy key file"
+
+	key := cfg.GiphyKeySecret()
+	if key == nil {
+		c.report(checkWarn, name, "not configured, Giphy is disabled")
+		return
+	}
+	if _, err := key.Get(); err != nil {
+		c.report(checkFail, name, "%v", err)
+		return
+	}
+
+	source := key.Source()
+	if source == cfg.GiphyApiKeyFile {
+		info, err := os.Stat(source)
+		if err != nil {
+			c.report(checkFail, name, "%v", err)
+			return
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			c.report(checkWarn, name, "%s is readable by other users (mode %s)", source, fileMode(info.Mode()))
+			return
+		}
+	}
+	if !services.WantsGiphy(cfg) {
+		c.report(checkWarn, name, "key from %s is present but neither MOTD_GIPHY_TAGS nor MOTD_RULES has Giphy tags, so nothing is fetched from Giphy", source)
+		return
+	}
+	c.report(checkOK, name, "key from %s", source)
+}
+
+// checkAdminToken checks the admin API token can be read when the admin
+// API is enabled
+func (c *checker) checkAdminToken(cfg *config.Config) {
+	const name = "admin token"
+
+	if cfg.AdminPort == 0 {
+		return
+	}
+	token := cfg.AdminTokenSecret()
+	if token == nil {
+		// Reported by the application check
+		return
+	}
+	if _, err := token.Get(); err != nil {
+		c.report(checkFail, name, "%v", err)
+		return
+	}
+	c.report(checkOK, name, "from %s", token.Source())
+}
+
+// checkTLS checks every configured certificate pair can be loaded
+func (c *checker) checkTLS(cfg *config.Config) {
+	pairs := map[string][2]string{}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		pairs["default"] = [2]string{cfg.TLSCertFile, cfg.TLSKeyFile}
+	}
+	for _, l := range cfg.Listeners {
+		if l.TLSCertFile != "" || l.TLSKeyFile != "" {
+			pairs[l.Name] = [2]string{l.TLSCertFile, l.TLSKeyFile}
+		}
+	}
+
+	for _, listener := range slices.Sorted(maps.Keys(pairs)) {
+		pair := pairs[listener]
+		name := "tls " + listener
+		if _, err := tls.LoadX509KeyPair(pair[0], pair[1]); err != nil {
+			c.report(checkFail, name, "%v", err)
+			continue
+		}
+		c.report(checkOK, name, "%s", pair[0])
+	}
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Captions maps a provider, or "*" for any other, to a caption template
+type Captions map[string]string
+
+// Decode implements envconfig.Decoder
+func (c *Captions) Decode(value string) error {
+	var captions map[string]string
+	if err := json.Unmarshal([]byte(value), &captions); err != nil {
+		return fmt.Errorf("invalid captions JSON: %w", err)
+	}
+
+	*c = captions
+	return nil
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestCaptions_Decode(t *testing.T) {
+	var captions Captions
+	if err := captions.Decode(`{"xkcd": "{{.Title}}: {{.Message}}", "*": "{{.Source}}, {{.Tag}}"}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captions["xkcd"] != "{{.Title}}: {{.Message}}" || captions["*"] != "{{.Source}}, {{.Tag}}" {
+		t.Errorf("unexpected captions %v", captions)
+	}
+
+	if err := captions.Decode(`["{{.Title}}"]`); err == nil {
+		t.Error("expected error for non-object JSON but got none")
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/stevielcb/motd-server/internal/secret"
 )
 
 // Config defines all configuration options for motd-server,
@@ -15,10 +19,111 @@ type Config struct {
 	MaxFileSize      int64             `split_words:"true" default:"10485760"` // 10MB in bytes
 	GiphyApiKeyFile  string            `split_words:"true"`
 	GiphyTags        map[string]string `split_words:"true"`
+	GiphyRendition   string            `split_words:"true" default:"original"` // e.g. fixed_width, webp or still
+	GiphyModes       map[string]string `split_words:"true"`                    // e.g. deploy:search,trending:trending
+	GiphyBaseURL     string            `envconfig:"GIPHY_BASE_URL"`            // defaults to https://api.giphy.com/v1/gifs
 	DownloadInterval int               `split_words:"true" default:"10"`
 	CleanupInterval  int               `split_words:"true" default:"60"`
 	ListenHost       string            `split_words:"true" default:"localhost"`
 	ListenPort       int               `split_words:"true" default:"4200"`
+	HTTPPort         int               `split_words:"true" default:"0"`     // 0 disables the HTTP listener
+	RequestTimeoutMs int               `split_words:"true" default:"0"`     // 0 serves without reading a request line
+	HistoryWindow    int               `split_words:"true" default:"10"`    // 0 disables no-repeat rotation
+	HistoryTTL       int               `split_words:"true" default:"86400"` // in seconds
+	HistoryFile      string            `split_words:"true"`
+
+	GiphyApiKey        string `split_words:"true"` // the key itself, preferred over the command and file
+	GiphyApiKeyCommand string `split_words:"true"` // prints the key, e.g. "pass show giphy"
+
+	SelectionWeights map[string]float64 `split_words:"true"`                // e.g. custom:60,giphy:30,xkcd:10
+	FreshnessBoost   float64            `split_words:"true" default:"1"`    // weight multiplier for new items
+	FreshnessWindow  int                `split_words:"true" default:"3600"` // in seconds
+
+	ListenSocket      string `split_words:"true"` // Unix socket served in addition to ListenPort
+	ListenSocketMode  string `split_words:"true" default:"0600"`
+	ListenSocketOwner string `split_words:"true"`
+
+	TLSCertFile     string `split_words:"true"` // enables TLS on the default and HTTP listeners
+	TLSKeyFile      string `split_words:"true"`
+	TLSClientCAFile string `split_words:"true"` // enables mutual TLS
+
+	AllowCIDRs []string `envconfig:"ALLOW_CIDRS"` // applied to the default, scoped and HTTP listeners
+	DenyCIDRs  []string `envconfig:"DENY_CIDRS"`
+
+	ProxyProtocol  string   `split_words:"true"` // "optional" or "strict", for the default listener
+	TrustedProxies []string `split_words:"true"` // CIDRs PROXY headers are accepted from
+
+	RateLimit      float64 `split_words:"true" default:"0"` // connections per second per client, 0 disables
+	RateBurst      int     `split_words:"true" default:"5"`
+	MaxConnections int     `split_words:"true" default:"128"`  // across all listeners, 0 disables
+	QueueTimeoutMs int     `split_words:"true" default:"1000"` // how long to wait for a free connection slot
+	WriteTimeout   int     `split_words:"true" default:"30"`   // in seconds
+
+	ShutdownTimeout int `split_words:"true" default:"10"` // seconds to drain connections on shutdown
+
+	AdminHost         string `split_words:"true" default:"localhost"`
+	AdminPort         int    `split_words:"true" default:"0"` // 0 disables the admin API
+	AdminToken        string `split_words:"true"`             // bearer token required by the admin API
+	AdminTokenFile    string `split_words:"true"`
+	AdminTokenCommand string `split_words:"true"`
+
+	ScopedPorts map[int]string `split_words:"true"` // e.g. 4201:source=xkcd,4202:tag=cats
+	Listeners   Listeners      `split_words:"true"` // JSON array replacing ListenHost/ListenPort
+
+	Rules    Rules  `split_words:"true"` // JSON array of time-based content rules
+	Timezone string `split_words:"true"` // for rules and captions, defaults to the local timezone
+
+	XKCDPrefer2x   bool   `envconfig:"XKCD_PREFER_2X"`                 // fetch double resolution images when available
+	XKCDTranscript bool   `envconfig:"XKCD_TRANSCRIPT"`                // include transcripts in captions
+	XKCDLatestTTL  int    `envconfig:"XKCD_LATEST_TTL" default:"3600"` // in seconds
+	XKCDSeenFile   string `envconfig:"XKCD_SEEN_FILE"`                 // comics already fetched, defaults to the cache directory
+	XKCDExclude    []int  `envconfig:"XKCD_EXCLUDE"`                   // comic numbers never to fetch
+	XKCDBaseURL    string `envconfig:"XKCD_BASE_URL"`                  // defaults to https://xkcd.com
+
+	OutboundProxy   string `split_words:"true"`              // for calls to providers, defaults to HTTPS_PROXY
+	OutboundTimeout int    `split_words:"true" default:"30"` // in seconds
+	OutboundCAFile  string `envconfig:"OUTBOUND_CA_FILE"`    // extra root CAs for calls to providers
+	UserAgent       string `split_words:"true"`              // sent to providers, defaults to motd-server/<version>
+
+	OutboundRateLimit float64 `split_words:"true" default:"0"` // requests per second to each provider host, 0 disables
+	OutboundRateBurst int     `split_words:"true" default:"5"`
+	OutboundDebug     bool    `split_words:"true"` // log every call to providers
+
+	Captions Captions          `split_words:"true"` // JSON object of caption templates by provider
+	Events   map[string]string `split_words:"true"` // e.g. freeze:2025-07-01, for caption countdowns
+
+	// Set by Load when GiphyApiKeyFile is the default rather than configured
+	defaultGiphyKeyFile bool
+}
+
+// GiphyKeySecret returns where the Giphy API key comes from, or nil if it
+// isn't configured. The default key file only counts if it exists.
+func (c *Config) GiphyKeySecret() *secret.Secret {
+	file := c.GiphyApiKeyFile
+	if c.defaultGiphyKeyFile {
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			file = ""
+		}
+	}
+	return secret.New(c.GiphyApiKey, file, c.GiphyApiKeyCommand)
+}
+
+// AdminTokenSecret returns where the admin API token comes from, or nil if
+// it isn't configured
+func (c *Config) AdminTokenSecret() *secret.Secret {
+	return secret.New(c.AdminToken, c.AdminTokenFile, c.AdminTokenCommand)
+}
+
+// Location returns the timezone rules and captions are evaluated in
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return loc, nil
 }
 
 // Load loads configuration from environment variables
@@ -30,17 +135,26 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if err := ValidateWeights(cfg.SelectionWeights); err != nil {
+		return nil, fmt.Errorf("invalid MOTD_SELECTION_WEIGHTS: %w", err)
+	}
+
 	// Set default values for paths
 	home := os.Getenv("HOME")
 
 	if cfg.GiphyApiKeyFile == "" {
 		cfg.GiphyApiKeyFile = home + "/.giphy-api"
+		cfg.defaultGiphyKeyFile = true
 	}
 
 	if cfg.CacheDir == "" {
 		cfg.CacheDir = home + "/.motd"
 	}
 
+	if cfg.XKCDSeenFile == "" {
+		cfg.XKCDSeenFile = cfg.CacheDir + "/.xkcd-seen.json"
+	}
+
 	// Ensure cache directory exists
 	if err := os.MkdirAll(cfg.CacheDir, 0700); err != nil {
 		return nil, err
@@ -51,10 +165,23 @@ func Load() (*Config, error) {
 		"giphyKeyFile", cfg.GiphyApiKeyFile,
 		"listenHost", cfg.ListenHost,
 		"listenPort", cfg.ListenPort,
+		"listenSocket", cfg.ListenSocket,
+		"tlsCertFile", cfg.TLSCertFile,
 		"downloadInterval", cfg.DownloadInterval,
 		"cleanupInterval", cfg.CleanupInterval,
 		"cacheMaxFiles", cfg.CacheMaxFiles,
 		"maxFileSize", cfg.MaxFileSize,
+		"httpPort", cfg.HTTPPort,
+		"adminPort", cfg.AdminPort,
+		"historyWindow", cfg.HistoryWindow,
+		"historyFile", cfg.HistoryFile,
+		"selectionWeights", cfg.SelectionWeights,
+		"freshnessBoost", cfg.FreshnessBoost,
+		"rateLimit", cfg.RateLimit,
+		"maxConnections", cfg.MaxConnections,
+		"scopedPorts", cfg.ScopedPorts,
+		"listeners", len(cfg.Listeners),
+		"rules", len(cfg.Rules),
 	)
 
 	return &cfg, nil
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Listener configures a dedicated listener with its own content policy
+type Listener struct {
+	Name            string   `json:"name"`
+	Host            string   `json:"host"`
+	Port            int      `json:"port"`
+	Socket          string   `json:"socket,omitempty"`       // Unix socket path, used instead of host/port
+	SocketMode      string   `json:"socket_mode,omitempty"`  // octal, e.g. "0660"
+	SocketOwner     string   `json:"socket_owner,omitempty"` // "user:group"
+	TLSCertFile     string   `json:"tls_cert_file,omitempty"`
+	TLSKeyFile      string   `json:"tls_key_file,omitempty"`
+	TLSClientCAFile string   `json:"tls_client_ca_file,omitempty"` // enables mutual TLS
+	Allow           []string `json:"allow,omitempty"`              // CIDRs allowed to connect (default: all)
+	Deny            []string `json:"deny,omitempty"`               // CIDRs refused, taking precedence over Allow
+	ProxyProtocol   string   `json:"proxy_protocol,omitempty"`     // "optional" or "strict"
+	TrustedProxies  []string `json:"trusted_proxies,omitempty"`    // CIDRs PROXY headers are accepted from
+	Sources         []string `json:"sources,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	MaxRating       string   `json:"max_rating,omitempty"`
+	Format          string   `json:"format,omitempty"`
+
+	Captions map[string]string `json:"captions,omitempty"` // override MOTD_CAPTIONS by provider
+}
+
+// Listeners is a list of listeners decoded from a JSON array
+type Listeners []Listener
+
+// Decode implements envconfig.Decoder
+func (l *Listeners) Decode(value string) error {
+	var listeners []Listener
+	if err := json.Unmarshal([]byte(value), &listeners); err != nil {
+		return fmt.Errorf("invalid listeners JSON: %w", err)
+	}
+
+	for i := range listeners {
+		if listeners[i].Name == "" {
+			listeners[i].Name = fmt.Sprintf("listener-%d", i)
+		}
+		if listeners[i].Host == "" {
+			listeners[i].Host = "localhost"
+		}
+	}
+
+	*l = listeners
+	return nil
+}
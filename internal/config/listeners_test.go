@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestListeners_Decode(t *testing.T) {
+	var listeners Listeners
+	err := listeners.Decode(`[
+		{"name": "work", "host": "0.0.0.0", "port": 4201, "sources": ["xkcd", "giphy"], "max_rating": "g", "format": "text"},
+		{"port": 4202}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+
+	work := listeners[0]
+	if work.Name != "work" || work.Host != "0.0.0.0" || work.Port != 4201 {
+		t.Errorf("unexpected listener %+v", work)
+	}
+	if len(work.Sources) != 2 || work.MaxRating != "g" || work.Format != "text" {
+		t.Errorf("unexpected policy %+v", work)
+	}
+
+	if listeners[1].Name != "listener-1" || listeners[1].Host != "localhost" {
+		t.Errorf("expected defaults to be applied, got %+v", listeners[1])
+	}
+}
+
+func TestListeners_Decode_Invalid(t *testing.T) {
+	var listeners Listeners
+	if err := listeners.Decode(`{"port": 4201}`); err == nil {
+		t.Error("expected error for non-array JSON but got none")
+	}
+}
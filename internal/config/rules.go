@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Rule changes what is fetched and served while its time conditions hold.
+// Conditions left empty always match.
+type Rule struct {
+	Name      string             `json:"name"`
+	Days      []string           `json:"days,omitempty"`       // e.g. ["sat", "sun"] or ["weekdays"]
+	Hours     string             `json:"hours,omitempty"`      // e.g. "09:00-17:00", may cross midnight
+	Dates     string             `json:"dates,omitempty"`      // e.g. "12-01..12-31", may cross the new year
+	MaxRating string             `json:"max_rating,omitempty"` // caps fetched and served ratings
+	Tags      []string           `json:"tags,omitempty"`       // served when clients don't ask for a scope
+	Weights   map[string]float64 `json:"weights,omitempty"`    // replaces MOTD_SELECTION_WEIGHTS
+	GiphyTags map[string]string  `json:"giphy_tags,omitempty"` // fetched in addition to MOTD_GIPHY_TAGS
+}
+
+// Rules is a list of rules decoded from a JSON array
+type Rules []Rule
+
+// Decode implements envconfig.Decoder
+func (r *Rules) Decode(value string) error {
+	var rules []Rule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return fmt.Errorf("invalid rules JSON: %w", err)
+	}
+
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := ValidateWeights(rules[i].Weights); err != nil {
+			return fmt.Errorf("invalid rule %s: %w", rules[i].Name, err)
+		}
+	}
+
+	*r = rules
+	return nil
+}
+
+// ValidateWeights checks selection weights are finite and not negative
+func ValidateWeights(weights map[string]float64) error {
+	for group, weight := range weights {
+		if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+			return fmt.Errorf("invalid weight %v for %q: must be a number of at least 0", weight, group)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRules_Decode(t *testing.T) {
+	var rules Rules
+	err := rules.Decode(`[
+		{"name": "office", "days": ["weekdays"], "hours": "09:00-17:00", "max_rating": "g"},
+		{"dates": "12-01..12-31", "giphy_tags": {"christmas": "g"}}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if office := rules[0]; office.Name != "office" || office.Hours != "09:00-17:00" || office.MaxRating != "g" {
+		t.Errorf("unexpected rule %+v", office)
+	}
+	if rules[1].Name != "rule-1" || rules[1].GiphyTags["christmas"] != "g" {
+		t.Errorf("expected defaults to be applied, got %+v", rules[1])
+	}
+
+	if err := rules.Decode(`{"name": "office"}`); err == nil {
+		t.Error("expected error for non-array JSON but got none")
+	}
+	if err := rules.Decode(`[{"name": "office", "weights": {"giphy": -1}}]`); err == nil {
+		t.Error("expected error for a negative weight but got none")
+	}
+}
+
+func TestValidateWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "valid", weights: map[string]float64{"giphy": 30, "xkcd": 0}},
+		{name: "negative", weights: map[string]float64{"giphy": -1}, wantErr: true},
+		{name: "nan", weights: map[string]float64{"giphy": math.NaN()}, wantErr: true},
+		{name: "infinite", weights: map[string]float64{"*": math.Inf(1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateWeights(tt.weights); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
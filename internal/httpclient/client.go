@@ -0,0 +1,177 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/config"
+)
+
+// Version is reported in the default User-Agent. The CLI sets it to the
+// build version.
+var Version = "dev"
+
+// maxIdleConnsPerHost keeps enough connections open to each provider for
+// downloads to reuse them
+const maxIdleConnsPerHost = 8
+
+// Options configures an outbound HTTP client
+type Options struct {
+	Proxy     string        // proxy URL, defaults to HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	Timeout   time.Duration // for a whole request, 0 for none
+	CAFile    string        // PEM root CAs trusted as well as the system's
+	UserAgent string        // defaults to DefaultUserAgent()
+
+	RateLimit float64      // requests per second to each host, 0 disables
+	RateBurst int          // requests allowed at once before the rate applies
+	Logger    *slog.Logger // logs every request and response if set
+}
+
+// DefaultUserAgent identifies the server and its version to upstream APIs
+func DefaultUserAgent() string {
+	return "motd-server/" + Version
+}
+
+// FromConfig creates the client shared by everything that calls out to
+// providers, logging requests to logger if MOTD_OUTBOUND_DEBUG is set
+func FromConfig(cfg *config.Config, logger *slog.Logger) (*http.Client, error) {
+	opts := Options{
+		Proxy:     cfg.OutboundProxy,
+		Timeout:   time.Duration(cfg.OutboundTimeout) * time.Second,
+		CAFile:    cfg.OutboundCAFile,
+		UserAgent: cfg.UserAgent,
+		RateLimit: cfg.OutboundRateLimit,
+		RateBurst: cfg.OutboundRateBurst,
+	}
+	if cfg.OutboundDebug {
+		opts.Logger = logger
+	}
+
+	client, err := New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbound HTTP client: %w", err)
+	}
+	return client, nil
+}
+
+// New creates an HTTP client for calls to upstream providers
+func New(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.CAFile != "" {
+		pool, err := certPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+
+	var limiter *hostLimiter
+	if opts.RateLimit > 0 {
+		limiter = newHostLimiter(opts.RateLimit, opts.RateBurst)
+	}
+
+	return &http.Client{
+		Transport: &outboundTransport{
+			next:      transport,
+			userAgent: userAgent,
+			limiter:   limiter,
+			logger:    opts.Logger,
+		},
+		Timeout: opts.Timeout,
+	}, nil
+}
+
+// certPool returns the system roots plus the certificates in caFile
+func certPool(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	dat, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(dat) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// outboundTransport sets the User-Agent, applies the per-host rate limit and
+// logs requests before handing them to the underlying transport
+type outboundTransport struct {
+	next      http.RoundTripper
+	userAgent string
+	limiter   *hostLimiter // nil disables rate limiting
+	logger    *slog.Logger // nil disables logging
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	waited, err := t.limiter.wait(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if t.logger != nil {
+		attrs := []any{"method", req.Method, "url", redact(req.URL), "duration", time.Since(start)}
+		if waited > 0 {
+			attrs = append(attrs, "rate_limited", waited)
+		}
+		if err != nil {
+			t.logger.Info("outbound request failed", append(attrs, "error", err)...)
+		} else {
+			t.logger.Info("outbound request", append(attrs, "status", resp.StatusCode, "content_length", resp.ContentLength)...)
+		}
+	}
+	return resp, err
+}
+
+// redact returns u with the values of query parameters that look like
+// credentials, such as Giphy's api_key, replaced
+func redact(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.String()
+	}
+	for name := range query {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "key") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") {
+			query.Set(name, "REDACTED")
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
@@ -0,0 +1,197 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/config"
+)
+
+func TestNew_UserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		header    string
+		want      string
+	}{
+		{name: "default", want: DefaultUserAgent()},
+		{name: "configured", userAgent: "acme-motd/1.0", want: "acme-motd/1.0"},
+		{name: "request header wins", userAgent: "acme-motd/1.0", header: "custom", want: "custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.UserAgent()
+			}))
+			defer server.Close()
+
+			client, err := New(Options{UserAgent: tt.userAgent})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			if tt.header != "" {
+				req.Header.Set("User-Agent", tt.header)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got != tt.want {
+				t.Errorf("expected User-Agent %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNew_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	client, err := New(Options{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get("http://upstream.invalid/info.0.json")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "via proxy" || proxied != "http://upstream.invalid/info.0.json" {
+		t.Errorf("expected request through the proxy, got %q for %q", body, proxied)
+	}
+}
+
+func TestNew_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemData, 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	// Without the CA the server's certificate is untrusted
+	client, err := New(Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("expected untrusted certificate error")
+	}
+
+	client, err = New(Options{CAFile: caFile, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA file failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "proxy without host", opts: Options{Proxy: "proxy.example.com:3128"}},
+		{name: "unparseable proxy", opts: Options{Proxy: "http://[::1"}},
+		{name: "missing CA file", opts: Options{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "CA file without certificates", opts: Options{CAFile: notPEM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts); err == nil {
+				t.Error("expected error but got none")
+			}
+		})
+	}
+}
+
+func TestNew_Logger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	client, err := New(Options{Logger: logger})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := client.Get(server.URL + "/random?api_key=secret-key&tag=cats")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	out := logs.String()
+	for _, want := range []string{"outbound request", "status=418", "api_key=REDACTED", "tag=cats"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got %s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret-key") {
+		t.Errorf("log leaks the API key: %s", out)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client, err := FromConfig(&config.Config{OutboundTimeout: 30, OutboundRateLimit: 1, OutboundDebug: true}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	transport := client.Transport.(*outboundTransport)
+	if client.Timeout != 30*time.Second || transport.limiter == nil || transport.logger != logger {
+		t.Errorf("client not configured from config: timeout %v, limiter %v, logger %v", client.Timeout, transport.limiter, transport.logger)
+	}
+	if transport.userAgent != "motd-server/"+Version {
+		t.Errorf("unexpected User-Agent %q", transport.userAgent)
+	}
+
+	client, err = FromConfig(&config.Config{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transport := client.Transport.(*outboundTransport); transport.limiter != nil || transport.logger != nil {
+		t.Error("expected rate limiting and logging to be off by default")
+	}
+
+	if _, err := FromConfig(&config.Config{OutboundProxy: "not a url"}, logger); err == nil {
+		t.Error("expected error for invalid proxy")
+	}
+}
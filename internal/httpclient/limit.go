@@ -0,0 +1,92 @@
+package httpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter applies a token bucket to each upstream host. Unlike the
+// server's limiter, which turns clients away, it makes requests wait.
+type hostLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket holds the tokens available for one host. Tokens go negative when
+// requests are waiting for them.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newHostLimiter allows rate requests per second to each host on average,
+// with bursts of up to burst requests
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// wait blocks until a request to host is allowed or ctx is done, returning
+// how long it waited. A nil limiter never waits.
+func (l *hostLimiter) wait(ctx context.Context, host string) (time.Duration, error) {
+	delay := l.reserve(host)
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		l.cancel(host)
+		return 0, ctx.Err()
+	}
+}
+
+// reserve takes a token for host and returns how long until it is available
+func (l *hostLimiter) reserve(host string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[host] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns a token reserved by a request that gave up waiting
+func (l *hostLimiter) cancel(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[host]; ok {
+		b.tokens = min(l.burst, b.tokens+1)
+	}
+}
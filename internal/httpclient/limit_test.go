@@ -0,0 +1,58 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter_reserve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newHostLimiter(2, 2)
+	limiter.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		host    string
+		want    time.Duration
+	}{
+		{name: "burst 1", host: "api.giphy.com", want: 0},
+		{name: "burst 2", host: "api.giphy.com", want: 0},
+		{name: "waits for a token", host: "api.giphy.com", want: 500 * time.Millisecond},
+		{name: "queues behind the waiting request", host: "api.giphy.com", want: time.Second},
+		{name: "other hosts are independent", host: "xkcd.com", want: 0},
+		{name: "refills over time", advance: 2 * time.Second, host: "api.giphy.com", want: 0},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if got := limiter.reserve(step.host); got != step.want {
+			t.Errorf("%s: reserve() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestHostLimiter_wait(t *testing.T) {
+	var limiter *hostLimiter
+	if waited, err := limiter.wait(context.Background(), "xkcd.com"); waited != 0 || err != nil {
+		t.Errorf("nil limiter waited %v, %v", waited, err)
+	}
+
+	limiter = newHostLimiter(0.1, 1)
+	if waited, err := limiter.wait(context.Background(), "xkcd.com"); waited != 0 || err != nil {
+		t.Fatalf("first request waited %v, %v", waited, err)
+	}
+
+	// The next token is ten seconds away, so a short deadline gives up and
+	// hands its reservation back
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.wait(ctx, "xkcd.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if tokens := limiter.buckets["xkcd.com"].tokens; tokens < -0.01 {
+		t.Errorf("expected the cancelled reservation to be returned, tokens = %v", tokens)
+	}
+}
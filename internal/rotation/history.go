@@ -0,0 +1,144 @@
+package rotation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// entry records a single item served to a client
+type entry struct {
+	ID       string    `json:"id"`
+	ServedAt time.Time `json:"served_at"`
+}
+
+// History tracks the items recently served to each client so they are not
+// repeated within a configurable window
+type History struct {
+	window int
+	ttl    time.Duration
+	path   string
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string][]entry
+}
+
+// NewHistory creates a history remembering the last window items per client
+// for at most ttl. If path is set, previously saved history is loaded from it
+// and Save persists the history there.
+func NewHistory(window int, ttl time.Duration, path string) (*History, error) {
+	h := &History{
+		window:  window,
+		ttl:     ttl,
+		path:    path,
+		now:     time.Now,
+		clients: make(map[string][]entry),
+	}
+
+	if path == "" {
+		return h, nil
+	}
+
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	if err := json.Unmarshal(dat, &h.clients); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal history file: %w", err)
+	}
+	h.prune()
+
+	return h, nil
+}
+
+// Recent returns the IDs served to the client within the window and TTL
+func (h *History) Recent(client string) map[string]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := h.now().Add(-h.ttl)
+	recent := make(map[string]bool)
+	for _, e := range h.clients[client] {
+		if e.ServedAt.After(cutoff) {
+			recent[e.ID] = true
+		}
+	}
+	return recent
+}
+
+// Record notes that the item with the given ID was served to the client
+func (h *History) Record(client, id string) {
+	if h.window <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := append(h.clients[client], entry{ID: id, ServedAt: h.now()})
+	if len(entries) > h.window {
+		entries = entries[len(entries)-h.window:]
+	}
+	h.clients[client] = entries
+}
+
+// Save drops expired entries and, if a path is configured, writes the
+// history to disk
+func (h *History) Save() error {
+	h.mu.Lock()
+	h.prune()
+	dat, err := json.Marshal(h.clients)
+	h.mu.Unlock()
+
+	if h.path == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn history
+	tmp := h.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("failed to replace history file: %w", err)
+	}
+
+	return nil
+}
+
+// prune removes expired entries and forgets clients with no recent items.
+// The caller must hold h.mu.
+func (h *History) prune() {
+	cutoff := h.now().Add(-h.ttl)
+	for client, entries := range h.clients {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.ServedAt.After(cutoff) {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) > h.window {
+			kept = kept[len(kept)-h.window:]
+		}
+		if len(kept) == 0 {
+			delete(h.clients, client)
+			continue
+		}
+		h.clients[client] = kept
+	}
+}
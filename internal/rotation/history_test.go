@@ -0,0 +1,86 @@
+package rotation
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory_RecentAndRecord(t *testing.T) {
+	history, err := NewHistory(2, time.Hour, "")
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+
+	history.Record("alice", "a")
+	history.Record("alice", "b")
+	history.Record("alice", "c")
+	history.Record("bob", "a")
+
+	recent := history.Recent("alice")
+	if len(recent) != 2 {
+		t.Errorf("expected 2 recent items, got %d", len(recent))
+	}
+	if recent["a"] {
+		t.Error("expected oldest item to fall out of the window")
+	}
+	if !recent["b"] || !recent["c"] {
+		t.Errorf("expected b and c to be recent, got %v", recent)
+	}
+
+	if !history.Recent("bob")["a"] {
+		t.Error("expected clients to be tracked independently")
+	}
+	if len(history.Recent("carol")) != 0 {
+		t.Error("expected unknown client to have no history")
+	}
+}
+
+func TestHistory_TTL(t *testing.T) {
+	history, err := NewHistory(10, time.Minute, "")
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+
+	now := time.Now()
+	history.now = func() time.Time { return now }
+	history.Record("alice", "a")
+
+	now = now.Add(2 * time.Minute)
+	if len(history.Recent("alice")) != 0 {
+		t.Error("expected expired item to be forgotten")
+	}
+}
+
+func TestHistory_DisabledWindow(t *testing.T) {
+	history, err := NewHistory(0, time.Hour, "")
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+
+	history.Record("alice", "a")
+	if len(history.Recent("alice")) != 0 {
+		t.Error("expected nothing to be recorded with a zero window")
+	}
+}
+
+func TestHistory_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	history, err := NewHistory(5, time.Hour, path)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	history.Record("alice", "a")
+	if err := history.Save(); err != nil {
+		t.Fatalf("failed to save history: %v", err)
+	}
+
+	loaded, err := NewHistory(5, time.Hour, path)
+	if err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if !loaded.Recent("alice")["a"] {
+		t.Error("expected history to survive a restart")
+	}
+}
@@ -0,0 +1,218 @@
+package schedule
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/config"
+)
+
+// dayNames maps the day names accepted in rules to the days they cover
+var dayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Effect is the combined result of the rules active at a moment
+type Effect struct {
+	// Rules names the active rules in configuration order
+	Rules []string
+	// MaxRating is the strictest rating cap of the active rules
+	MaxRating string
+	// Tags are the tags to serve, from every active rule
+	Tags []string
+	// Weights are the selection weights of the last active rule setting any
+	Weights map[string]float64
+	// GiphyTags are the extra Giphy tags to fetch, from every active rule
+	GiphyTags map[string]string
+}
+
+// Schedule evaluates time-based content rules. A nil Schedule has no rules.
+type Schedule struct {
+	rules []rule
+	loc   *time.Location
+	now   func() time.Time
+}
+
+// rule is a config.Rule with its conditions parsed
+type rule struct {
+	config.Rule
+	days     map[time.Weekday]bool
+	from, to int // minutes since midnight, or -1 for all day
+	start    int // month*100 + day, or 0 for all year
+	end      int
+}
+
+// New compiles rules evaluated in loc. now is the clock to use, time.Now if nil.
+func New(rules config.Rules, loc *time.Location, now func() time.Time) (*Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	s := &Schedule{loc: loc, now: now}
+	for _, r := range rules {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %w", r.Name, err)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	return s, nil
+}
+
+// FromConfig compiles the configured rules in the configured timezone
+func FromConfig(cfg *config.Config) (*Schedule, error) {
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg.Rules, loc, nil)
+}
+
+// compile parses a rule's conditions
+func compile(r config.Rule) (rule, error) {
+	c := rule{Rule: r, from: -1, to: -1}
+
+	if r.MaxRating != "" && !cache.ValidRating(r.MaxRating) {
+		return c, fmt.Errorf("unknown max rating %q", r.MaxRating)
+	}
+
+	if len(r.Days) > 0 {
+		c.days = make(map[time.Weekday]bool)
+		for _, name := range r.Days {
+			days, ok := dayNames[strings.ToLower(name)]
+			if !ok {
+				return c, fmt.Errorf("unknown day %q", name)
+			}
+			for _, day := range days {
+				c.days[day] = true
+			}
+		}
+	}
+
+	if r.Hours != "" {
+		from, to, ok := strings.Cut(r.Hours, "-")
+		if !ok {
+			return c, fmt.Errorf("invalid hours %q: want HH:MM-HH:MM", r.Hours)
+		}
+		var err error
+		if c.from, err = parseClock(from); err != nil {
+			return c, err
+		}
+		if c.to, err = parseClock(to); err != nil {
+			return c, err
+		}
+	}
+
+	if r.Dates != "" {
+		start, end, ok := strings.Cut(r.Dates, "..")
+		if !ok {
+			end = start
+		}
+		var err error
+		if c.start, err = parseDate(start); err != nil {
+			return c, err
+		}
+		if c.end, err = parseDate(end); err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: want HH:MM", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDate parses "MM-DD" into month*100 + day
+func parseDate(v string) (int, error) {
+	t, err := time.Parse("01-02", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q: want MM-DD", v)
+	}
+	return int(t.Month())*100 + t.Day(), nil
+}
+
+// matches reports whether the rule's conditions hold at t
+func (r rule) matches(t time.Time) bool {
+	if r.days != nil && !r.days[t.Weekday()] {
+		return false
+	}
+	if r.from >= 0 && !within(t.Hour()*60+t.Minute(), r.from, r.to) {
+		return false
+	}
+	if r.start > 0 && !within(int(t.Month())*100+t.Day(), r.start, r.end+1) {
+		return false
+	}
+	return true
+}
+
+// within reports whether v is in [from, to), wrapping around when to is
+// before from
+func within(v, from, to int) bool {
+	if from <= to {
+		return v >= from && v < to
+	}
+	return v >= from || v < to
+}
+
+// Active returns the effect of the rules active now
+func (s *Schedule) Active() Effect {
+	if s == nil {
+		return Effect{}
+	}
+	return s.At(s.now())
+}
+
+// At returns the effect of the rules active at t
+func (s *Schedule) At(t time.Time) Effect {
+	var e Effect
+	if s == nil {
+		return e
+	}
+
+	t = t.In(s.loc)
+	for _, r := range s.rules {
+		if !r.matches(t) {
+			continue
+		}
+
+		e.Rules = append(e.Rules, r.Name)
+		e.MaxRating = cache.StricterRating(e.MaxRating, r.MaxRating)
+		for _, tag := range r.Tags {
+			if !slices.Contains(e.Tags, tag) {
+				e.Tags = append(e.Tags, tag)
+			}
+		}
+		if len(r.Weights) > 0 {
+			e.Weights = r.Weights
+		}
+		if len(r.GiphyTags) > 0 {
+			if e.GiphyTags == nil {
+				e.GiphyTags = make(map[string]string)
+			}
+			maps.Copy(e.GiphyTags, r.GiphyTags)
+		}
+	}
+	return e
+}
@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/config"
+)
+
+func TestSchedule_At(t *testing.T) {
+	rules := config.Rules{
+		{Name: "office", Days: []string{"weekdays"}, Hours: "09:00-17:00", MaxRating: "g", Weights: map[string]float64{"xkcd": 1}},
+		{Name: "friday", Days: []string{"Fri"}, GiphyTags: map[string]string{"friday": "pg"}},
+		{Name: "night", Hours: "22:00-06:00", Tags: []string{"calm"}, MaxRating: "pg"},
+		{Name: "holidays", Dates: "12-20..01-05", Tags: []string{"holiday", "calm"}, GiphyTags: map[string]string{"christmas": "g"}},
+	}
+	s, err := New(rules, time.UTC, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want Effect
+	}{
+		{
+			name: "weekday morning",
+			at:   time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC), // Tuesday
+			want: Effect{Rules: []string{"office"}, MaxRating: "g", Weights: map[string]float64{"xkcd": 1}},
+		},
+		{
+			name: "friday afternoon",
+			at:   time.Date(2025, 6, 6, 16, 59, 0, 0, time.UTC),
+			want: Effect{Rules: []string{"office", "friday"}, MaxRating: "g", Weights: map[string]float64{"xkcd": 1}, GiphyTags: map[string]string{"friday": "pg"}},
+		},
+		{
+			name: "friday after work",
+			at:   time.Date(2025, 6, 6, 17, 0, 0, 0, time.UTC),
+			want: Effect{Rules: []string{"friday"}, GiphyTags: map[string]string{"friday": "pg"}},
+		},
+		{
+			name: "saturday",
+			at:   time.Date(2025, 6, 7, 12, 0, 0, 0, time.UTC),
+			want: Effect{},
+		},
+		{
+			name: "after midnight",
+			at:   time.Date(2025, 6, 8, 5, 59, 0, 0, time.UTC),
+			want: Effect{Rules: []string{"night"}, MaxRating: "pg", Tags: []string{"calm"}},
+		},
+		{
+			name: "new year's eve night",
+			at:   time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC),
+			want: Effect{Rules: []string{"night", "holidays"}, MaxRating: "pg", Tags: []string{"calm", "holiday"}, GiphyTags: map[string]string{"christmas": "g"}},
+		},
+		{
+			name: "last day of the holidays",
+			at:   time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC), // Monday
+			want: Effect{Rules: []string{"office", "holidays"}, MaxRating: "g", Tags: []string{"holiday", "calm"}, Weights: map[string]float64{"xkcd": 1}, GiphyTags: map[string]string{"christmas": "g"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.At(tt.at); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("At() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	now := time.Date(2025, 6, 6, 12, 0, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	// Rules are evaluated in the schedule's timezone: noon UTC is 21:00 JST
+	s, err := New(config.Rules{{Name: "evening", Hours: "18:00-23:00"}}, tokyo, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := s.Active().Rules; !reflect.DeepEqual(got, []string{"evening"}) {
+		t.Errorf("Active().Rules = %v, want [evening]", got)
+	}
+
+	var none *Schedule
+	if got := none.Active(); !reflect.DeepEqual(got, Effect{}) {
+		t.Errorf("nil schedule Active() = %+v, want no effect", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.Rule
+	}{
+		{name: "day", rule: config.Rule{Days: []string{"funday"}}},
+		{name: "hours", rule: config.Rule{Hours: "9-5"}},
+		{name: "hours without range", rule: config.Rule{Hours: "09:00"}},
+		{name: "dates", rule: config.Rule{Dates: "12-32"}},
+		{name: "rating", rule: config.Rule{MaxRating: "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(config.Rules{tt.rule}, nil, nil); err == nil {
+				t.Error("expected error but got none")
+			}
+		})
+	}
+
+	if _, err := FromConfig(&config.Config{Timezone: "Nowhere/Special"}); err == nil {
+		t.Error("expected error for an unknown timezone")
+	}
+}
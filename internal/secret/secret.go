@@ -0,0 +1,135 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotConfigured is returned by a nil Secret
+var ErrNotConfigured = errors.New("secret not configured")
+
+const (
+	commandRefresh = 5 * time.Minute  // how long a command's output is reused
+	commandTimeout = 10 * time.Second // how long a command may run
+)
+
+// Secret resolves a value such as an API key from, in order of preference,
+// the value itself (usually from an environment variable), the output of a
+// command such as a password manager CLI, or a file. Files are re-read when
+// they change and commands are re-run every few minutes, so rotated secrets
+// are picked up without a restart. Surrounding whitespace is trimmed.
+type Secret struct {
+	value   string
+	command string
+	file    string
+	now     func() time.Time
+
+	mu        sync.Mutex
+	cached    string
+	modTime   time.Time // of the file when cached was read
+	fetchedAt time.Time // when the command last produced cached
+}
+
+// New returns a secret taken from value, command or file, whichever is set
+// first, or nil if none are
+func New(value, file, command string) *Secret {
+	if value == "" && file == "" && command == "" {
+		return nil
+	}
+	return &Secret{value: value, command: command, file: file, now: time.Now}
+}
+
+// Source describes where the secret comes from, without revealing it
+func (s *Secret) Source() string {
+	switch {
+	case s == nil:
+		return "none"
+	case s.value != "":
+		return "environment"
+	case s.command != "":
+		return "command"
+	default:
+		return s.file
+	}
+}
+
+// Get returns the current value of the secret
+func (s *Secret) Get() (string, error) {
+	if s == nil {
+		return "", ErrNotConfigured
+	}
+	if s.value != "" {
+		return strings.TrimSpace(s.value), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.command != "" {
+		return s.run()
+	}
+	return s.read()
+}
+
+// run returns the command's output, re-running it once the cached output is
+// older than commandRefresh. The caller must hold s.mu.
+func (s *Secret) run() (string, error) {
+	now := s.now()
+	if s.cached != "" && now.Sub(s.fetchedAt) < commandRefresh {
+		return s.cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("failed to run secret command: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("failed to run secret command: %w", err)
+	}
+
+	value := strings.TrimSpace(string(out))
+	if value == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+
+	s.cached, s.fetchedAt = value, now
+	return value, nil
+}
+
+// read returns the file's contents, re-reading it when its modification
+// time changes. The caller must hold s.mu.
+func (s *Secret) read() (string, error) {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	if s.cached != "" && info.ModTime().Equal(s.modTime) {
+		return s.cached, nil
+	}
+
+	dat, err := os.ReadFile(s.file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	value := strings.TrimSpace(string(dat))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", s.file)
+	}
+
+	s.cached, s.modTime = value, info.ModTime()
+	return value, nil
+}
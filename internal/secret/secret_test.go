@@ -0,0 +1,125 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecret_Get(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatalf("failed to write empty file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		file       string
+		command    string
+		want       string
+		wantSource string
+		wantErr    string
+	}{
+		{name: "value", value: " from-env\n", file: keyFile, command: "echo cmd", want: "from-env", wantSource: "environment"},
+		{name: "command", file: keyFile, command: "echo '  from-command  '", want: "from-command", wantSource: "command"},
+		{name: "file", file: keyFile, want: "from-file", wantSource: keyFile},
+		{name: "command fails", command: "echo broken >&2; exit 3", wantSource: "command", wantErr: "broken"},
+		{name: "command prints nothing", command: "true", wantSource: "command", wantErr: "printed nothing"},
+		{name: "missing file", file: filepath.Join(dir, "missing"), wantSource: filepath.Join(dir, "missing"), wantErr: "failed to read secret file"},
+		{name: "empty file", file: emptyFile, wantSource: emptyFile, wantErr: "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(tt.value, tt.file, tt.command)
+			if got := s.Source(); got != tt.wantSource {
+				t.Errorf("Source() = %q, want %q", got, tt.wantSource)
+			}
+
+			got, err := s.Get()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Get() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Get() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecret_NotConfigured(t *testing.T) {
+	s := New("", "", "")
+	if s != nil {
+		t.Fatalf("New() = %+v, want nil", s)
+	}
+	if _, err := s.Get(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Get() error = %v, want ErrNotConfigured", err)
+	}
+	if got := s.Source(); got != "none" {
+		t.Errorf("Source() = %q, want none", got)
+	}
+}
+
+func TestSecret_FileRotation(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("old"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	s := New("", keyFile, "")
+	if got, _ := s.Get(); got != "old" {
+		t.Fatalf("Get() = %q, want old", got)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("new"), 0600); err != nil {
+		t.Fatalf("failed to rewrite key file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	if got, _ := s.Get(); got != "new" {
+		t.Errorf("Get() after rotation = %q, want new", got)
+	}
+}
+
+func TestSecret_CommandRefresh(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	// Prints how many times the command has run
+	s := New("", "", "echo x >> "+counter+"; wc -l < "+counter)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	first, err := s.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if first != "1" {
+		t.Fatalf("Get() = %q, want 1", first)
+	}
+
+	now = now.Add(commandRefresh / 2)
+	if got, _ := s.Get(); got != first {
+		t.Errorf("Get() before refresh = %q, want cached %q", got, first)
+	}
+
+	now = now.Add(commandRefresh)
+	if got, _ := s.Get(); got != "2" {
+		t.Errorf("Get() after refresh = %q, want 2", got)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ACL decides which client addresses may connect based on CIDR lists
+type ACL struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// ParseACL builds an ACL from allow and deny lists of CIDRs or single
+// addresses. Deny entries take precedence; if any allow entries are given,
+// only matching addresses are allowed.
+func ParseACL(allow, deny []string) (*ACL, error) {
+	a := &ACL{}
+	var err error
+	if a.allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parsePrefixes parses CIDRs, treating bare addresses as single-host prefixes
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// IsEmpty reports whether the ACL allows every address
+func (a *ACL) IsEmpty() bool {
+	return a == nil || (len(a.allow) == 0 && len(a.deny) == 0)
+}
+
+// Allows reports whether a client at addr may connect. Addresses without an
+// IP, such as Unix socket peers, are always allowed.
+func (a *ACL) Allows(addr net.Addr) bool {
+	if a.IsEmpty() {
+		return true
+	}
+
+	ip, ok := addrIP(addr)
+	if !ok {
+		return true
+	}
+
+	for _, prefix := range a.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, prefix := range a.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedProxies lists the peers allowed to send PROXY protocol headers
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a list of CIDRs or single addresses of proxies
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	return parsePrefixes(entries)
+}
+
+// Trusts reports whether the peer at addr may send PROXY headers. Peers
+// without an IP, such as Unix socket clients, are trusted as access to the
+// socket is controlled by its permissions.
+func (t TrustedProxies) Trusts(addr net.Addr) bool {
+	ip, ok := addrIP(addr)
+	if !ok {
+		return addr != nil
+	}
+	for _, prefix := range t {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP extracts the IP address from a network address
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, ok := netip.AddrFromSlice(a.IP)
+		return ip.Unmap(), ok
+	case nil:
+		return netip.Addr{}, false
+	}
+
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseACL_Invalid(t *testing.T) {
+	if _, err := ParseACL([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("expected error for invalid CIDR but got none")
+	}
+	if _, err := ParseACL(nil, []string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid address but got none")
+	}
+}
+
+func TestACL_Allows(t *testing.T) {
+	acl, err := ParseACL([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatalf("failed to parse acl: %v", err)
+	}
+
+	tests := []struct {
+		addr     net.Addr
+		expected bool
+	}{
+		{addr: &net.TCPAddr{IP: net.ParseIP("10.2.3.4")}, expected: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("10.1.3.4")}, expected: false},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.5")}, expected: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.6")}, expected: false},
+		{addr: &net.TCPAddr{IP: net.ParseIP("::ffff:10.2.3.4")}, expected: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1")}, expected: true},
+		{addr: &net.UnixAddr{Name: "/run/motd.sock", Net: "unix"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr.String(), func(t *testing.T) {
+			if got := acl.Allows(tt.addr); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	var empty *ACL
+	if !empty.Allows(&net.TCPAddr{IP: net.ParseIP("8.8.8.8")}) {
+		t.Error("expected nil ACL to allow everything")
+	}
+}
+
+func TestTCPServer_ACLDenied(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	acl, err := ParseACL(nil, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("failed to parse acl: %v", err)
+	}
+	port := freePort(t)
+
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithACL(acl))
+	go server.Start()
+	defer server.Stop(context.Background())
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port))); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	response, _ := io.ReadAll(conn)
+	conn.Close()
+	if len(response) > 0 {
+		t.Errorf("expected no content for denied client, got %s", response)
+	}
+
+	if stats := server.Stats(); stats.Denied != 1 || stats.Accepted != 0 {
+		t.Errorf("expected 1 denied and 0 accepted, got %+v", stats)
+	}
+}
+
+func TestHTTPServer_ACLDenied(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	acl, err := ParseACL([]string{"10.0.0.0/8"}, nil)
+	if err != nil {
+		t.Fatalf("failed to parse acl: %v", err)
+	}
+
+	server := NewHTTPServer("localhost", 0, cacheManager, logger, WithACL(acl))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rec.Code)
+	}
+	if stats := server.Stats(); stats.Denied != 1 {
+		t.Errorf("expected 1 denied request, got %+v", stats)
+	}
+}
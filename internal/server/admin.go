@@ -0,0 +1,455 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// ErrUnknownWorker is returned for a background worker that doesn't exist
+var ErrUnknownWorker = errors.New("unknown worker")
+
+// errBadRequest marks admin requests with invalid input
+var errBadRequest = errors.New("bad request")
+
+// maxUploadSize caps the size of a pushed item's request body. The cache
+// applies its own, usually lower, file size limit.
+const maxUploadSize = 64 << 20
+
+// WorkerState describes a background worker
+type WorkerState struct {
+	Name      string    `json:"name"`
+	Interval  string    `json:"interval"`
+	Running   bool      `json:"running"`
+	LastRun   time.Time `json:"last_run,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// AdminBackend is the application the admin API operates on
+type AdminBackend interface {
+	Items() ([]cache.Item, error)
+	Item(id string) (cache.Item, []byte, error)
+	AddItem(data []byte, name string, meta cache.Metadata) (cache.Item, error)
+	SetItemWindow(id string, notBefore, notAfter time.Time) error
+	DeleteItem(id string) error
+	PinItem(id string, pinned bool) error
+	BanItem(id string) ([]string, error)
+	Bans() (cache.Bans, error)
+	AddBan(url, hash string) ([]string, error)
+	RemoveBan(url, hash string) error
+	Fetch(provider string) error
+	Providers() []services.ProviderState
+	SetProviderEnabled(provider string, enabled bool) error
+	Workers() []WorkerState
+	SetWorkerInterval(name string, interval time.Duration) error
+	Cleanup() ([]string, error)
+}
+
+// TokenSource provides the admin API token, which may change while the
+// server runs
+type TokenSource interface {
+	Get() (string, error)
+}
+
+// admin serves the admin API for one backend
+type admin struct {
+	backend AdminBackend
+	token   TokenSource
+	logger  *slog.Logger
+}
+
+// NewAdminServer creates an HTTP server exposing the admin API. Every
+// request must carry the current token as a bearer token.
+func NewAdminServer(host string, port int, backend AdminBackend, token TokenSource, logger *slog.Logger, opts ...Option) *HTTPServer {
+	s := newHTTPServer(host, port, logger, opts)
+	a := &admin{backend: backend, token: token, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items", a.handleItems)
+	mux.HandleFunc("POST /items", a.handleAdd)
+	mux.HandleFunc("GET /items/{id}", a.handleItem)
+	mux.HandleFunc("PATCH /items/{id}", a.handleWindow)
+	mux.HandleFunc("GET /items/{id}/content", a.handleContent)
+	mux.HandleFunc("DELETE /items/{id}", a.handleDelete)
+	mux.HandleFunc("PUT /items/{id}/pin", a.handlePin(true))
+	mux.HandleFunc("DELETE /items/{id}/pin", a.handlePin(false))
+	mux.HandleFunc("POST /items/{id}/ban", a.handleBan)
+	mux.HandleFunc("GET /bans", a.handleBans)
+	mux.HandleFunc("POST /bans", a.handleAddBan)
+	mux.HandleFunc("DELETE /bans", a.handleRemoveBan)
+	mux.HandleFunc("GET /providers", a.handleProviders)
+	mux.HandleFunc("PATCH /providers/{name}", a.handleProvider)
+	mux.HandleFunc("POST /providers/{name}/fetch", a.handleFetch)
+	mux.HandleFunc("GET /workers", a.handleWorkers)
+	mux.HandleFunc("PATCH /workers/{name}", a.handleWorker)
+	mux.HandleFunc("POST /cleanup", a.handleCleanup)
+	s.server.Handler = s.guard(a.authenticate(mux))
+
+	return s
+}
+
+// authenticate rejects requests without the admin token and logs the rest
+func (a *admin) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want, err := a.token.Get()
+		if err != nil {
+			a.logger.Error("failed to read admin token", "error", err)
+			writeError(w, http.StatusServiceUnavailable, "admin token unavailable")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			a.logger.Warn("unauthorized admin request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		a.logger.Info("admin request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleItems lists cached items, optionally filtered by the "provider",
+// "tag" and "q" (search text) query parameters
+func (a *admin) handleItems(w http.ResponseWriter, r *http.Request) {
+	items, err := a.backend.Items()
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	provider, tag, search := query.Get("provider"), query.Get("tag"), query.Get("q")
+	filtered := make([]cache.Item, 0, len(items))
+	for _, item := range items {
+		if (provider == "" || item.Provider == provider) && (tag == "" || item.Tag == tag) && (search == "" || item.Contains(search)) {
+			filtered = append(filtered, item)
+		}
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+// handleAdd stores a pushed item from a multipart form with an optional
+// "file" image, a "message", comma separated "tags" and a publishing window
+// of "not_before" and "not_after" (or "expires") times
+func (a *admin) handleAdd(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		a.fail(w, fmt.Errorf("%w: invalid form: %v", errBadRequest, err))
+		return
+	}
+
+	meta := cache.Metadata{
+		Provider: "custom",
+		Message:  strings.TrimSpace(r.FormValue("message")),
+	}
+	for _, tag := range strings.Split(r.FormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	if len(meta.Tags) > 0 {
+		meta.Tag = meta.Tags[0]
+	}
+
+	notAfter := r.FormValue("not_after")
+	if notAfter == "" {
+		notAfter = r.FormValue("expires")
+	}
+	var err error
+	if meta.NotBefore, meta.NotAfter, err = parseWindow(r.FormValue("not_before"), notAfter); err != nil {
+		a.fail(w, err)
+		return
+	}
+
+	var data []byte
+	var name string
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			a.fail(w, fmt.Errorf("%w: failed to read file: %v", errBadRequest, err))
+			return
+		}
+		name = header.Filename
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		a.fail(w, fmt.Errorf("%w: invalid file: %v", errBadRequest, err))
+		return
+	}
+
+	if len(data) == 0 && meta.Message == "" {
+		a.fail(w, fmt.Errorf("%w: a file or message is required", errBadRequest))
+		return
+	}
+
+	item, err := a.backend.AddItem(data, name, meta)
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// parseWindow parses the optional ends of a publishing window
+func parseWindow(notBefore, notAfter string) (time.Time, time.Time, error) {
+	now := time.Now()
+	var window [2]time.Time
+	for i, v := range []string{notBefore, notAfter} {
+		if v == "" {
+			continue
+		}
+		t, err := cache.ParseTime(v, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		window[i] = t
+	}
+	return window[0], window[1], nil
+}
+
+// handleWindow changes when an item is published, from a JSON body with
+// "not_before" and "not_after" times. Empty or missing times clear that end
+// of the window.
+func (a *admin) handleWindow(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		NotBefore string `json:"not_before"`
+		NotAfter  string `json:"not_after"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		a.fail(w, err)
+		return
+	}
+	notBefore, notAfter, err := parseWindow(body.NotBefore, body.NotAfter)
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+
+	if err := a.backend.SetItemWindow(r.PathValue("id"), notBefore, notAfter); err != nil {
+		a.fail(w, err)
+		return
+	}
+	a.handleItem(w, r)
+}
+
+// handleItem returns one item's metadata
+func (a *admin) handleItem(w http.ResponseWriter, r *http.Request) {
+	item, _, err := a.backend.Item(r.PathValue("id"))
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleContent returns one item's cached content
+func (a *admin) handleContent(w http.ResponseWriter, r *http.Request) {
+	_, data, err := a.backend.Item(r.PathValue("id"))
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// handleDelete removes an item from the cache
+func (a *admin) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := a.backend.DeleteItem(r.PathValue("id")); err != nil {
+		a.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePin pins or unpins an item
+func (a *admin) handlePin(pinned bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.backend.PinItem(r.PathValue("id"), pinned); err != nil {
+			a.fail(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleBan bans an item's URL and content, returning the deleted item IDs
+func (a *admin) handleBan(w http.ResponseWriter, r *http.Request) {
+	deleted, err := a.backend.BanItem(r.PathValue("id"))
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"deleted": deleted})
+}
+
+// handleBans returns the banned URLs and content hashes
+func (a *admin) handleBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := a.backend.Bans()
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+// handleAddBan bans a URL and/or content hash from a JSON body with "url"
+// and "sha256", returning the deleted item IDs
+func (a *admin) handleAddBan(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL    string `json:"url"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		a.fail(w, err)
+		return
+	}
+	if body.URL == "" && body.SHA256 == "" {
+		a.fail(w, fmt.Errorf("%w: url or sha256 is required", errBadRequest))
+		return
+	}
+
+	deleted, err := a.backend.AddBan(body.URL, body.SHA256)
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"deleted": deleted})
+}
+
+// handleRemoveBan lifts the ban on the "url" and/or "sha256" query parameters
+func (a *admin) handleRemoveBan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	url, hash := query.Get("url"), query.Get("sha256")
+	if url == "" && hash == "" {
+		a.fail(w, fmt.Errorf("%w: url or sha256 is required", errBadRequest))
+		return
+	}
+
+	if err := a.backend.RemoveBan(url, hash); err != nil {
+		a.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleProviders returns every provider's state
+func (a *admin) handleProviders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.backend.Providers())
+}
+
+// handleProvider enables or disables scheduled downloads from a provider
+func (a *admin) handleProvider(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		a.fail(w, err)
+		return
+	}
+	if body.Enabled == nil {
+		a.fail(w, fmt.Errorf("%w: enabled is required", errBadRequest))
+		return
+	}
+
+	if err := a.backend.SetProviderEnabled(r.PathValue("name"), *body.Enabled); err != nil {
+		a.fail(w, err)
+		return
+	}
+	a.handleProviders(w, r)
+}
+
+// handleFetch downloads from a provider immediately
+func (a *admin) handleFetch(w http.ResponseWriter, r *http.Request) {
+	if err := a.backend.Fetch(r.PathValue("name")); err != nil {
+		a.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWorkers returns every background worker's state
+func (a *admin) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.backend.Workers())
+}
+
+// handleWorker changes how often a background worker runs
+func (a *admin) handleWorker(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Interval string `json:"interval"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		a.fail(w, err)
+		return
+	}
+	interval, err := time.ParseDuration(body.Interval)
+	if err != nil || interval <= 0 {
+		a.fail(w, fmt.Errorf("%w: interval must be a positive duration such as \"30s\"", errBadRequest))
+		return
+	}
+
+	if err := a.backend.SetWorkerInterval(r.PathValue("name"), interval); err != nil {
+		a.fail(w, err)
+		return
+	}
+	a.handleWorkers(w, r)
+}
+
+// handleCleanup prunes the cache now, returning the removed item IDs
+func (a *admin) handleCleanup(w http.ResponseWriter, r *http.Request) {
+	removed, err := a.backend.Cleanup()
+	if err != nil {
+		a.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"removed": removed})
+}
+
+// fail writes the status matching err
+func (a *admin) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, cache.ErrInvalidWindow):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, cache.ErrNotFound), errors.Is(err, services.ErrUnknownProvider), errors.Is(err, ErrUnknownWorker):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, cache.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, cache.ErrBanned), errors.Is(err, services.ErrNotConfigured):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		a.logger.Error("admin request failed", "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// decodeJSON reads a JSON request body into v
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid body: %v", errBadRequest, err)
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// mockAdminBackend records the calls made by the admin API
+type mockAdminBackend struct {
+	items    []cache.Item
+	pinned   map[string]bool
+	deleted  []string
+	fetched  []string
+	enabled  map[string]bool
+	interval time.Duration
+	bans     cache.Bans
+}
+
+// staticToken is a TokenSource that never changes
+type staticToken string
+
+func (t staticToken) Get() (string, error) {
+	return string(t), nil
+}
+
+// brokenToken is a TokenSource that can't be read
+type brokenToken struct{}
+
+func (brokenToken) Get() (string, error) {
+	return "", fmt.Errorf("token file missing")
+}
+
+func (m *mockAdminBackend) Items() ([]cache.Item, error) {
+	return m.items, nil
+}
+
+func (m *mockAdminBackend) Item(id string) (cache.Item, []byte, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, []byte("content of " + id), nil
+		}
+	}
+	return cache.Item{}, nil, fmt.Errorf("%w: %s", cache.ErrNotFound, id)
+}
+
+func (m *mockAdminBackend) AddItem(data []byte, name string, meta cache.Metadata) (cache.Item, error) {
+	if int64(len(data)) > 4 {
+		return cache.Item{}, cache.ErrTooLarge
+	}
+	item := cache.Item{ID: "3_" + name, Metadata: meta}
+	m.items = append(m.items, item)
+	return item, nil
+}
+
+func (m *mockAdminBackend) SetItemWindow(id string, notBefore, notAfter time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			if !notBefore.IsZero() && !notAfter.IsZero() && !notBefore.Before(notAfter) {
+				return cache.ErrInvalidWindow
+			}
+			m.items[i].NotBefore, m.items[i].NotAfter = notBefore, notAfter
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", cache.ErrNotFound, id)
+}
+
+func (m *mockAdminBackend) DeleteItem(id string) error {
+	if _, _, err := m.Item(id); err != nil {
+		return err
+	}
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *mockAdminBackend) PinItem(id string, pinned bool) error {
+	m.pinned[id] = pinned
+	return nil
+}
+
+func (m *mockAdminBackend) BanItem(id string) ([]string, error) {
+	return []string{id}, nil
+}
+
+func (m *mockAdminBackend) Bans() (cache.Bans, error) {
+	return m.bans, nil
+}
+
+func (m *mockAdminBackend) AddBan(url, hash string) ([]string, error) {
+	if url != "" {
+		m.bans.URLs = append(m.bans.URLs, url)
+	}
+	if hash != "" {
+		m.bans.Hashes = append(m.bans.Hashes, hash)
+	}
+	return []string{"1_a"}, nil
+}
+
+func (m *mockAdminBackend) RemoveBan(url, hash string) error {
+	m.bans.URLs = slices.DeleteFunc(m.bans.URLs, func(u string) bool { return u == url })
+	m.bans.Hashes = slices.DeleteFunc(m.bans.Hashes, func(h string) bool { return h == hash })
+	return nil
+}
+
+func (m *mockAdminBackend) Fetch(provider string) error {
+	if provider != "xkcd" {
+		return fmt.Errorf("%w: %s", services.ErrUnknownProvider, provider)
+	}
+	m.fetched = append(m.fetched, provider)
+	return nil
+}
+
+func (m *mockAdminBackend) Providers() []services.ProviderState {
+	return []services.ProviderState{{Name: "xkcd", Enabled: m.enabled["xkcd"], Breaker: services.BreakerClosed}}
+}
+
+func (m *mockAdminBackend) SetProviderEnabled(provider string, enabled bool) error {
+	m.enabled[provider] = enabled
+	return nil
+}
+
+func (m *mockAdminBackend) Workers() []WorkerState {
+	return []WorkerState{{Name: "download", Interval: m.interval.String()}}
+}
+
+func (m *mockAdminBackend) SetWorkerInterval(name string, interval time.Duration) error {
+	if name != "download" {
+		return fmt.Errorf("%w: %s", ErrUnknownWorker, name)
+	}
+	m.interval = interval
+	return nil
+}
+
+func (m *mockAdminBackend) Cleanup() ([]string, error) {
+	return []string{"old"}, nil
+}
+
+func TestAdminServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	backend := &mockAdminBackend{
+		items: []cache.Item{
+			{ID: "1_a", Metadata: cache.Metadata{Provider: "giphy", Tag: "cats"}},
+			{ID: "2_b", Metadata: cache.Metadata{Provider: "xkcd", Title: "Exploits of a Mom"}},
+		},
+		pinned:   map[string]bool{},
+		enabled:  map[string]bool{"xkcd": true},
+		interval: 10 * time.Second,
+	}
+	server := NewAdminServer("localhost", 0, backend, staticToken("secret"), logger)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "missing token", method: http.MethodGet, target: "/items", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, target: "/items", token: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "list items", method: http.MethodGet, target: "/items", token: "secret", wantStatus: http.StatusOK, wantBody: `"id":"2_b"`},
+		{name: "filter items", method: http.MethodGet, target: "/items?provider=giphy", token: "secret", wantStatus: http.StatusOK, wantBody: `[{"id":"1_a"`},
+		{name: "search items", method: http.MethodGet, target: "/items?q=mom", token: "secret", wantStatus: http.StatusOK, wantBody: `[{"id":"2_b"`},
+		{name: "get item", method: http.MethodGet, target: "/items/1_a", token: "secret", wantStatus: http.StatusOK, wantBody: `"tag":"cats"`},
+		{name: "get content", method: http.MethodGet, target: "/items/1_a/content", token: "secret", wantStatus: http.StatusOK, wantBody: "content of 1_a"},
+		{name: "missing item", method: http.MethodGet, target: "/items/nope", token: "secret", wantStatus: http.StatusNotFound},
+		{name: "schedule item", method: http.MethodPatch, target: "/items/1_a", body: `{"not_before":"2030-01-01T00:00:00Z","not_after":"2030-01-02T00:00:00Z"}`, token: "secret", wantStatus: http.StatusOK, wantBody: `"not_before":"2030-01-01T00:00:00Z"`},
+		{name: "inverted window", method: http.MethodPatch, target: "/items/1_a", body: `{"not_before":"2030-01-02T00:00:00Z","not_after":"2030-01-01T00:00:00Z"}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "delete item", method: http.MethodDelete, target: "/items/2_b", token: "secret", wantStatus: http.StatusNoContent},
+		{name: "pin item", method: http.MethodPut, target: "/items/1_a/pin", token: "secret", wantStatus: http.StatusNoContent},
+		{name: "ban item", method: http.MethodPost, target: "/items/1_a/ban", token: "secret", wantStatus: http.StatusOK, wantBody: `{"deleted":["1_a"]}`},
+		{name: "ban url", method: http.MethodPost, target: "/bans", body: `{"url":"https://example.com/a.gif"}`, token: "secret", wantStatus: http.StatusOK, wantBody: `{"deleted":["1_a"]}`},
+		{name: "ban hash", method: http.MethodPost, target: "/bans", body: `{"sha256":"abc"}`, token: "secret", wantStatus: http.StatusOK},
+		{name: "ban nothing", method: http.MethodPost, target: "/bans", body: `{}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "list bans", method: http.MethodGet, target: "/bans", token: "secret", wantStatus: http.StatusOK, wantBody: `{"urls":["https://example.com/a.gif"],"sha256":["abc"]}`},
+		{name: "lift ban", method: http.MethodDelete, target: "/bans?sha256=abc", token: "secret", wantStatus: http.StatusNoContent},
+		{name: "lift nothing", method: http.MethodDelete, target: "/bans", token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "fetch", method: http.MethodPost, target: "/providers/xkcd/fetch", token: "secret", wantStatus: http.StatusNoContent},
+		{name: "fetch unknown provider", method: http.MethodPost, target: "/providers/nope/fetch", token: "secret", wantStatus: http.StatusNotFound},
+		{name: "disable provider", method: http.MethodPatch, target: "/providers/xkcd", body: `{"enabled":false}`, token: "secret", wantStatus: http.StatusOK, wantBody: `"enabled":false`},
+		{name: "provider without enabled", method: http.MethodPatch, target: "/providers/xkcd", body: `{}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "set interval", method: http.MethodPatch, target: "/workers/download", body: `{"interval":"1m"}`, token: "secret", wantStatus: http.StatusOK, wantBody: `"interval":"1m0s"`},
+		{name: "invalid interval", method: http.MethodPatch, target: "/workers/download", body: `{"interval":"-1s"}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "unknown worker", method: http.MethodPatch, target: "/workers/nope", body: `{"interval":"1s"}`, token: "secret", wantStatus: http.StatusNotFound},
+		{name: "cleanup", method: http.MethodPost, target: "/cleanup", token: "secret", wantStatus: http.StatusOK, wantBody: `{"removed":["old"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+			if rec.Code >= 400 && !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("error body %q is not JSON", rec.Body.String())
+			}
+		})
+	}
+
+	if len(backend.deleted) != 1 || backend.deleted[0] != "2_b" {
+		t.Errorf("deleted = %v, want [2_b]", backend.deleted)
+	}
+	if !backend.pinned["1_a"] {
+		t.Error("expected 1_a to be pinned")
+	}
+	if len(backend.fetched) != 1 {
+		t.Errorf("fetched = %v, want one xkcd fetch", backend.fetched)
+	}
+	if len(backend.bans.URLs) != 1 || len(backend.bans.Hashes) != 0 {
+		t.Errorf("bans = %+v, want only the URL left", backend.bans)
+	}
+	if backend.interval != time.Minute {
+		t.Errorf("interval = %s, want 1m", backend.interval)
+	}
+}
+
+func TestAdminServer_AddItem(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		file       string
+		wantStatus int
+		wantMeta   cache.Metadata
+	}{
+		{
+			name:       "text",
+			fields:     map[string]string{"message": "release 1.2 shipped", "tags": "release, ci"},
+			wantStatus: http.StatusCreated,
+			wantMeta:   cache.Metadata{Provider: "custom", Message: "release 1.2 shipped", Tag: "release", Tags: []string{"release", "ci"}},
+		},
+		{
+			name:       "image with expiry",
+			fields:     map[string]string{"expires": "2030-01-02T03:04:05Z"},
+			file:       "gif",
+			wantStatus: http.StatusCreated,
+			wantMeta:   cache.Metadata{Provider: "custom", NotAfter: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			name:       "scheduled",
+			fields:     map[string]string{"message": "maintenance tonight", "not_before": "2030-01-01T22:00:00Z", "not_after": "2030-01-02T02:00:00Z"},
+			wantStatus: http.StatusCreated,
+			wantMeta:   cache.Metadata{Provider: "custom", Message: "maintenance tonight", NotBefore: time.Date(2030, 1, 1, 22, 0, 0, 0, time.UTC), NotAfter: time.Date(2030, 1, 2, 2, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:       "empty",
+			fields:     map[string]string{"tags": "ci"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid expiry",
+			fields:     map[string]string{"message": "hi", "expires": "tomorrow"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			file:       "too large",
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &mockAdminBackend{}
+			server := NewAdminServer("localhost", 0, backend, staticToken("secret"), logger)
+
+			var body strings.Builder
+			form := multipart.NewWriter(&body)
+			for k, v := range tt.fields {
+				form.WriteField(k, v)
+			}
+			if tt.file != "" {
+				part, _ := form.CreateFormFile("file", "banner.gif")
+				part.Write([]byte(tt.file))
+			}
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body.String()))
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rec := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var item cache.Item
+			if err := json.Unmarshal(rec.Body.Bytes(), &item); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if !reflect.DeepEqual(item.Metadata, tt.wantMeta) {
+				t.Errorf("metadata = %+v, want %+v", item.Metadata, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestAdminServer_TokenUnavailable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := NewAdminServer("localhost", 0, &mockAdminBackend{}, brokenToken{}, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
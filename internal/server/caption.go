@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// Captions renders the caption shown under each item from a template chosen
+// by the item's provider. A nil Captions leaves captions as cached.
+type Captions struct {
+	templates map[string]*template.Template
+	events    map[string]time.Time
+	hostname  string
+	loc       *time.Location
+	now       func() time.Time
+	logger    *slog.Logger
+}
+
+// captionData is what caption templates can refer to
+type captionData struct {
+	Title    string
+	Message  string // the caption cached with the item, such as XKCD's alt text
+	Source   string
+	Tag      string
+	Tags     []string
+	URL      string
+	Fetched  time.Time
+	Now      time.Time
+	Hostname string
+	Client   string // the client's ID or address
+
+	Number     int
+	Published  time.Time
+	Permalink  string
+	Transcript string
+
+	events map[string]time.Time
+}
+
+// NewCaptions parses caption templates keyed by provider, with "*" for any
+// other provider, and the dates ("2006-01-02") of events templates can count
+// down to. It returns nil if there are no templates.
+func NewCaptions(templates, events map[string]string, loc *time.Location, logger *slog.Logger) (*Captions, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	c := &Captions{
+		templates: make(map[string]*template.Template, len(templates)),
+		events:    make(map[string]time.Time, len(events)),
+		hostname:  hostname,
+		loc:       loc,
+		now:       time.Now,
+		logger:    logger,
+	}
+
+	for provider, text := range templates {
+		tmpl, err := template.New(provider).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid caption template for %s: %w", provider, err)
+		}
+		c.templates[provider] = tmpl
+	}
+
+	for name, date := range events {
+		t, err := time.ParseInLocation(time.DateOnly, date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date for event %s: %w", name, err)
+		}
+		c.events[name] = t
+	}
+
+	return c, nil
+}
+
+// apply replaces an item's cached caption with its rendered template. The
+// cached caption is kept if the template fails.
+func (c *Captions) apply(item cache.Item, data []byte, client string) (cache.Item, []byte) {
+	if c == nil {
+		return item, data
+	}
+
+	tmpl, ok := c.templates[item.Provider]
+	if !ok {
+		if tmpl, ok = c.templates["*"]; !ok {
+			return item, data
+		}
+	}
+
+	now := c.now().In(c.loc)
+	var b strings.Builder
+	err := tmpl.Execute(&b, captionData{
+		Title:    item.Title,
+		Message:  item.Message,
+		Source:   item.Provider,
+		Tag:      item.Tag,
+		Tags:     item.Tags,
+		URL:      item.URL,
+		Fetched:  item.FetchedAt.In(c.loc),
+		Now:      now,
+		Hostname: c.hostname,
+		Client:   client,
+		events:   c.events,
+
+		Number:     item.Number,
+		Published:  item.Published,
+		Permalink:  item.Permalink,
+		Transcript: item.Transcript,
+	})
+	if err != nil {
+		c.logger.Warn("failed to render caption", "provider", item.Provider, "id", item.ID, "error", err)
+		return item, data
+	}
+	caption := strings.TrimSpace(b.String())
+
+	// Cached content ends with the cached caption and a newline, if any
+	if item.Message != "" {
+		data = bytes.TrimSuffix(data, []byte(item.Message+"\n"))
+	}
+	if caption != "" {
+		data = append(bytes.Clone(data), caption+"\n"...)
+	}
+
+	item.Message = caption
+	return item, data
+}
+
+// DaysUntil returns the number of days from today until the named event, or
+// a negative number once it has passed
+func (d captionData) DaysUntil(event string) (int, error) {
+	date, ok := d.events[event]
+	if !ok {
+		return 0, fmt.Errorf("unknown event %q", event)
+	}
+
+	today := time.Date(d.Now.Year(), d.Now.Month(), d.Now.Day(), 0, 0, 0, 0, d.Now.Location())
+	return int(date.Sub(today).Round(24*time.Hour) / (24 * time.Hour)), nil
+}
+
+// Greeting returns "Good morning", "Good afternoon" or "Good evening"
+func (d captionData) Greeting() string {
+	switch h := d.Now.Hour(); {
+	case h >= 5 && h < 12:
+		return "Good morning"
+	case h >= 12 && h < 18:
+		return "Good afternoon"
+	default:
+		return "Good evening"
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+func TestCaptions_Apply(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	captions, err := NewCaptions(map[string]string{
+		"xkcd":   `{{.Greeting}} {{.Client}} — {{.DaysUntil "freeze"}} days to the release freeze`,
+		"giphy":  `{{.Tag}} on {{.Hostname}}`,
+		"custom": `{{.DaysUntil "nope"}}`,
+		"*":      `{{.Message}} ({{.Source}}, {{.Fetched.Format "2006-01-02"}})`,
+	}, map[string]string{"freeze": "2025-06-09"}, time.UTC, logger)
+	if err != nil {
+		t.Fatalf("NewCaptions() error = %v", err)
+	}
+	captions.now = func() time.Time { return time.Date(2025, 6, 6, 8, 30, 0, 0, time.UTC) }
+	captions.hostname = "motd.example"
+
+	fetched := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		item        cache.Item
+		data        string
+		wantData    string
+		wantMessage string
+	}{
+		{
+			name:        "replaces cached caption",
+			item:        cache.Item{Metadata: cache.Metadata{Provider: "xkcd", Message: "alt text"}},
+			data:        "1337;File=inline=1:AAAAalt text\n",
+			wantData:    "1337;File=inline=1:AAAAGood morning laptop — 3 days to the release freeze\n",
+			wantMessage: "Good morning laptop — 3 days to the release freeze",
+		},
+		{
+			name:        "adds caption",
+			item:        cache.Item{Metadata: cache.Metadata{Provider: "giphy", Tag: "cats"}},
+			data:        "1337;File=inline=1:AAAA",
+			wantData:    "1337;File=inline=1:AAAAcats on motd.example\n",
+			wantMessage: "cats on motd.example",
+		},
+		{
+			name:        "default template for text items",
+			item:        cache.Item{Metadata: cache.Metadata{Provider: "other", Message: "release shipped", FetchedAt: fetched}},
+			data:        "release shipped\n",
+			wantData:    "release shipped (other, 2025-06-01)\n",
+			wantMessage: "release shipped (other, 2025-06-01)",
+		},
+		{
+			name:        "failing template keeps cached caption",
+			item:        cache.Item{Metadata: cache.Metadata{Provider: "custom", Message: "on-call: alice"}},
+			data:        "on-call: alice\n",
+			wantData:    "on-call: alice\n",
+			wantMessage: "on-call: alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, data := captions.apply(tt.item, []byte(tt.data), "laptop")
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+			if item.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", item.Message, tt.wantMessage)
+			}
+		})
+	}
+
+	var none *Captions
+	if _, data := none.apply(cache.Item{}, []byte("as cached"), "laptop"); string(data) != "as cached" {
+		t.Errorf("nil captions changed data to %q", data)
+	}
+}
+
+func TestNewCaptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if c, err := NewCaptions(nil, map[string]string{"freeze": "2025-06-09"}, nil, logger); c != nil || err != nil {
+		t.Errorf("expected nil captions without templates, got %v, %v", c, err)
+	}
+	if _, err := NewCaptions(map[string]string{"xkcd": "{{.Title"}, nil, nil, logger); err == nil {
+		t.Error("expected error for an invalid template")
+	}
+	if _, err := NewCaptions(map[string]string{"xkcd": "{{.Title}}"}, map[string]string{"freeze": "July"}, nil, logger); err == nil {
+		t.Error("expected error for an invalid event date")
+	}
+}
+
+func TestCaptionData(t *testing.T) {
+	events := map[string]time.Time{
+		"freeze": time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC),
+		"launch": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		now      time.Time
+		event    string
+		want     int
+		greeting string
+	}{
+		{now: time.Date(2025, 6, 6, 23, 59, 0, 0, time.UTC), event: "freeze", want: 3, greeting: "Good evening"},
+		{now: time.Date(2025, 6, 9, 12, 0, 0, 0, time.UTC), event: "freeze", want: 0, greeting: "Good afternoon"},
+		{now: time.Date(2025, 6, 6, 5, 0, 0, 0, time.UTC), event: "launch", want: -5, greeting: "Good morning"},
+	}
+
+	for _, tt := range tests {
+		d := captionData{Now: tt.now, events: events}
+		got, err := d.DaysUntil(tt.event)
+		if err != nil || got != tt.want {
+			t.Errorf("DaysUntil(%q) at %s = %d, %v; want %d", tt.event, tt.now, got, err, tt.want)
+		}
+		if g := d.Greeting(); g != tt.greeting {
+			t.Errorf("Greeting() at %s = %q, want %q", tt.now, g, tt.greeting)
+		}
+	}
+
+	if _, err := (captionData{}).DaysUntil("missing"); err == nil {
+		t.Error("expected error for an unknown event")
+	}
+}
+
+func TestSelectFor_CaptionClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	captions, err := NewCaptions(map[string]string{"*": "hello {{.Client}}"}, nil, time.UTC, logger)
+	if err != nil {
+		t.Fatalf("NewCaptions() error = %v", err)
+	}
+	o := newOptions([]Option{WithCaptions(captions), WithFormat(FormatText)})
+	cacheManager := &mockCacheManager{returnData: []byte("cached\n")}
+
+	tests := []struct {
+		clientID string
+		remote   string
+		want     string
+	}{
+		{clientID: "laptop", remote: "10.0.0.1:51202", want: "hello laptop"},
+		{remote: "10.0.0.1:51202", want: "hello 10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		data, err := selectFor(cacheManager, o, clientKey(tt.clientID, tt.remote), cache.Scope{})
+		if err != nil {
+			t.Fatalf("selectFor() error = %v", err)
+		}
+		if !strings.Contains(string(data), tt.want) || strings.Contains(string(data), ":") {
+			t.Errorf("selectFor() = %q, want caption %q", data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// selectFor picks cached content for a client according to the configured
+// policy, weights and schedule rules, avoiding the items it has been served
+// recently, and renders it with its caption in the configured format. The requested scope
+// takes precedence over the server's default scope, which takes precedence
+// over the tags of active rules.
+func selectFor(cacheManager services.CacheManager, o options, client string, scope cache.Scope) ([]byte, error) {
+	effect := o.schedule.Active()
+	if scope.IsEmpty() {
+		scope = o.scope
+	}
+	if scope.IsEmpty() && len(effect.Tags) > 0 {
+		scope = cache.Scope{Tags: effect.Tags}
+	}
+
+	policy := o.policy
+	policy.MaxRating = cache.StricterRating(policy.MaxRating, effect.MaxRating)
+	weights := o.weights
+	if effect.Weights != nil {
+		weights.Groups = effect.Weights
+	}
+
+	history := o.history
+	q := cache.Query{Policy: policy, Scope: scope, Weights: weights}
+	if history != nil {
+		q.Exclude = history.Recent(client)
+	}
+
+	item, data, err := cacheManager.Select(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if history != nil {
+		history.Record(client, item.ID)
+	}
+
+	item, data = o.captions.apply(item, data, clientName(client))
+	return render(o.format, item, data)
+}
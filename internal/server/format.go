@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// Format determines how a cached item is written to clients
+type Format string
+
+const (
+	// FormatITerm writes the cached inline image payload as stored
+	FormatITerm Format = "iterm"
+	// FormatText writes the item's message and source URL as plain text
+	FormatText Format = "text"
+	// FormatJSON writes the item's metadata as a JSON object
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a format name, defaulting to FormatITerm
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "":
+		return FormatITerm, nil
+	case FormatITerm, FormatText, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q", name)
+	}
+}
+
+// render writes the item and its cached content in the given format
+func render(format Format, item cache.Item, data []byte) ([]byte, error) {
+	switch format {
+	case FormatText:
+		var b strings.Builder
+		if item.Message != "" {
+			b.WriteString(item.Message + "\n")
+		}
+		if item.URL != "" {
+			b.WriteString(item.URL + "\n")
+		}
+		return []byte(b.String()), nil
+	case FormatJSON:
+		out, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal item: %w", err)
+		}
+		return append(out, '\n'), nil
+	default:
+		return data, nil
+	}
+}
+
+// contentType returns the HTTP content type for the format
+func (f Format) contentType() string {
+	if f == FormatJSON {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
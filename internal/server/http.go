@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/stevielcb/motd-server/internal/services"
+)
+
+// ClientHeader lets HTTP clients identify themselves for no-repeat rotation
+const ClientHeader = "X-MOTD-Client"
+
+// HTTPServer serves cached content over HTTP
+type HTTPServer struct {
+	host     string
+	port     int
+	cache    services.CacheManager
+	logger   *slog.Logger
+	opts     options
+	server   *http.Server
+	counters counters
+	ready    chan struct{}
+}
+
+// NewHTTPServer creates a new HTTP server instance
+func NewHTTPServer(host string, port int, cache services.CacheManager, logger *slog.Logger, opts ...Option) *HTTPServer {
+	s := newHTTPServer(host, port, logger, opts)
+	s.cache = cache
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleMOTD)
+	s.server.Handler = s.guard(mux)
+
+	return s
+}
+
+// newHTTPServer creates an HTTP server without a handler
+func newHTTPServer(host string, port int, logger *slog.Logger, opts []Option) *HTTPServer {
+	s := &HTTPServer{
+		host:   host,
+		port:   port,
+		logger: logger,
+		opts:   newOptions(opts),
+		ready:  make(chan struct{}),
+	}
+
+	s.server = &http.Server{
+		Addr:              net.JoinHostPort(host, fmt.Sprint(port)),
+		ReadHeaderTimeout: handshakeTimeout,
+		WriteTimeout:      s.opts.writeTimeout,
+	}
+	return s
+}
+
+// Start begins listening for HTTP requests
+func (s *HTTPServer) Start() error {
+	l := s.opts.listener
+	if l == nil {
+		var err error
+		l, err = net.Listen("tcp", s.server.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to start http server: %w", err)
+		}
+	}
+
+	if s.opts.tls != nil {
+		tlsConfig, err := newTLSConfig(*s.opts.tls, s.logger)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("failed to start http server: %w", err)
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	s.logger.Info("http server started", "name", s.opts.name, "address", l.Addr().String(), "tls", s.opts.tls != nil)
+	close(s.ready)
+
+	if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server failed: %w", err)
+	}
+	return nil
+}
+
+// Ready is closed once the server is listening
+func (s *HTTPServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Stop stops accepting requests and waits for in-flight ones to finish.
+// Connections still open when ctx is done are closed forcibly.
+func (s *HTTPServer) Stop(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return fmt.Errorf("failed to drain http connections: %w", err)
+	}
+	return nil
+}
+
+// guard rejects requests from addresses the ACL doesn't allow and applies
+// the rate and concurrency limits, counting the outcome
+func (s *HTTPServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.opts.acl.IsEmpty() {
+			addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+			if err != nil || !s.opts.acl.Allows(addr) {
+				s.counters.denied.Add(1)
+				s.logger.Warn("request denied by acl", "remote", r.RemoteAddr)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		if !s.opts.rateLimiter.Allow(clientKey("", r.RemoteAddr)) {
+			s.counters.rateLimited.Add(1)
+			s.logger.Warn("request rate limited", "remote", r.RemoteAddr)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, busyMessage, http.StatusTooManyRequests)
+			return
+		}
+
+		if !s.opts.connLimiter.Acquire() {
+			s.counters.rejected.Add(1)
+			s.logger.Warn("too many requests, rejecting", "remote", r.RemoteAddr)
+			http.Error(w, busyMessage, http.StatusServiceUnavailable)
+			return
+		}
+		defer s.opts.connLimiter.Release()
+
+		s.counters.accepted.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stats returns the server's request counters
+func (s *HTTPServer) Stats() Stats {
+	return s.counters.snapshot()
+}
+
+// handleMOTD serves a random cached item, optionally limited by the "tag"
+// and "source" query parameters
+func (s *HTTPServer) handleMOTD(w http.ResponseWriter, r *http.Request) {
+	client := clientKey(r.Header.Get(ClientHeader), r.RemoteAddr)
+	data, err := selectFor(s.cache, s.opts, client, ParseScope(r.URL.Query()))
+	if err != nil {
+		s.logger.Error("failed to get random file", "error", err)
+		http.Error(w, "no content available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", s.opts.format.contentType())
+	if _, err := w.Write(data); err != nil {
+		s.logger.Error("failed to write response", "error", err)
+	}
+}
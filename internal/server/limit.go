@@ -0,0 +1,136 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// busyMessage is written to clients turned away by a limit
+const busyMessage = "motd-server is busy, please try again later\n"
+
+// RateLimiter applies a token bucket to each client address
+type RateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket holds the tokens available to one client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each client rate connections per second on average,
+// with bursts of up to burst connections
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow reports whether the client identified by key may connect now,
+// consuming a token if so. A nil limiter allows everything.
+func (r *RateLimiter) Allow(key string) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens = min(r.burst, b.tokens+now.Sub(b.last).Seconds()*r.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep forgets clients whose buckets have refilled, bounding memory use.
+// The caller must hold r.mu.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+
+	for key, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= r.burst {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// ConnLimiter caps the number of connections served at once. Connections
+// over the cap wait in a queue for up to queueTimeout.
+type ConnLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// NewConnLimiter allows up to max concurrent connections
+func NewConnLimiter(max int, queueTimeout time.Duration) *ConnLimiter {
+	return &ConnLimiter{
+		slots:        make(chan struct{}, max),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire takes a connection slot, waiting up to the queue timeout for one
+// to free up. It reports whether a slot was taken; a nil limiter always
+// succeeds.
+func (l *ConnLimiter) Acquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queueTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *ConnLimiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		want    bool
+	}{
+		{name: "first burst token", key: "addr:10.0.0.1", want: true},
+		{name: "second burst token", key: "addr:10.0.0.1", want: true},
+		{name: "burst exhausted", key: "addr:10.0.0.1", want: false},
+		{name: "other client unaffected", key: "addr:10.0.0.2", want: true},
+		{name: "half a token refilled", advance: 500 * time.Millisecond, key: "addr:10.0.0.1", want: false},
+		{name: "full token refilled", advance: 500 * time.Millisecond, key: "addr:10.0.0.1", want: true},
+		{name: "refill capped at burst", advance: time.Hour, key: "addr:10.0.0.1", want: true},
+		{name: "second token after long idle", key: "addr:10.0.0.1", want: true},
+		{name: "third token after long idle", key: "addr:10.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			if got := limiter.Allow(tt.key); got != tt.want {
+				t.Errorf("Allow(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("addr:10.0.0.1")
+	now = now.Add(2 * time.Minute)
+	limiter.Allow("addr:10.0.0.2")
+
+	if _, ok := limiter.buckets["addr:10.0.0.1"]; ok {
+		t.Error("expected idle bucket to be swept")
+	}
+	if _, ok := limiter.buckets["addr:10.0.0.2"]; !ok {
+		t.Error("expected active bucket to be kept")
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	var nilLimiter *ConnLimiter
+	if !nilLimiter.Acquire() {
+		t.Error("expected nil limiter to always acquire")
+	}
+	nilLimiter.Release()
+
+	limiter := NewConnLimiter(1, 50*time.Millisecond)
+	if !limiter.Acquire() {
+		t.Fatal("expected first acquire to succeed")
+	}
+
+	start := time.Now()
+	if limiter.Acquire() {
+		t.Fatal("expected acquire over the cap to fail")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected acquire to queue for the timeout, waited %v", elapsed)
+	}
+
+	// A slot freed while queued is handed to the waiter
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		limiter.Release()
+	}()
+	if !limiter.Acquire() {
+		t.Error("expected queued acquire to succeed once a slot is released")
+	}
+}
+
+func TestTCPServer_RateLimited(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	port := freePort(t)
+
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithRateLimiter(NewRateLimiter(0.001, 1)))
+	go server.Start()
+	defer server.Stop(context.Background())
+
+	addr := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+	read := func() string {
+		t.Helper()
+		var conn net.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+		response, _ := io.ReadAll(conn)
+		return string(response)
+	}
+
+	if response := read(); response != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+	if response := read(); response != busyMessage {
+		t.Errorf("expected busy message, got %s", response)
+	}
+
+	if stats := server.Stats(); stats.RateLimited != 1 {
+		t.Errorf("expected 1 rate limited connection, got %+v", stats)
+	}
+}
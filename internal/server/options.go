@@ -0,0 +1,196 @@
+package server
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/rotation"
+	"github.com/stevielcb/motd-server/internal/schedule"
+)
+
+// Option configures optional server behaviour
+type Option func(*options)
+
+// options holds the settings shared by the TCP and HTTP servers
+type options struct {
+	name           string
+	history        *rotation.History
+	schedule       *schedule.Schedule
+	requestTimeout time.Duration
+	weights        cache.Weights
+	scope          cache.Scope
+	policy         cache.Policy
+	format         Format
+	captions       *Captions
+
+	tls            *TLSConfig
+	acl            *ACL
+	proxy          ProxyMode
+	trustedProxies TrustedProxies
+
+	rateLimiter  *RateLimiter
+	connLimiter  *ConnLimiter
+	writeTimeout time.Duration
+
+	listener    net.Listener
+	socketPath  string
+	socketMode  os.FileMode
+	socketOwner string
+}
+
+// WithName names the listener in logs
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithHistory avoids serving a client the items it has seen recently
+func WithHistory(history *rotation.History) Option {
+	return func(o *options) {
+		o.history = history
+	}
+}
+
+// WithSchedule applies time-based rules to the ratings, tags and weights
+// served
+func WithSchedule(s *schedule.Schedule) Option {
+	return func(o *options) {
+		o.schedule = s
+	}
+}
+
+// WithWeights biases selection between providers and towards new items
+func WithWeights(weights cache.Weights) Option {
+	return func(o *options) {
+		o.weights = weights
+	}
+}
+
+// WithScope sets the tags and sources served to clients that don't ask for
+// any themselves
+func WithScope(scope cache.Scope) Option {
+	return func(o *options) {
+		o.scope = scope
+	}
+}
+
+// WithPolicy restricts the items the server may serve, whatever the client asks for
+func WithPolicy(policy cache.Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithCaptions renders item captions from templates
+func WithCaptions(captions *Captions) Option {
+	return func(o *options) {
+		o.captions = captions
+	}
+}
+
+// WithFormat sets how items are written to clients
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithListener serves on an already open listener, such as one passed in by
+// systemd socket activation, instead of binding an address
+func WithListener(l net.Listener) Option {
+	return func(o *options) {
+		o.listener = l
+	}
+}
+
+// WithUnixSocket makes the server listen on a Unix socket at path instead of
+// TCP. A non-zero mode and an owner in "user:group" form are applied to the
+// socket file once created.
+func WithUnixSocket(path string, mode os.FileMode, owner string) Option {
+	return func(o *options) {
+		o.socketPath = path
+		o.socketMode = mode
+		o.socketOwner = owner
+	}
+}
+
+// WithTLS serves connections over TLS, optionally requiring client certificates
+func WithTLS(cfg TLSConfig) Option {
+	return func(o *options) {
+		o.tls = &cfg
+	}
+}
+
+// WithACL refuses connections from addresses the ACL doesn't allow
+func WithACL(acl *ACL) Option {
+	return func(o *options) {
+		o.acl = acl
+	}
+}
+
+// WithProxyProtocol reads PROXY protocol headers from connections so the
+// original client address is used for access control, rate limiting and
+// rotation
+func WithProxyProtocol(mode ProxyMode) Option {
+	return func(o *options) {
+		o.proxy = mode
+	}
+}
+
+// WithTrustedProxies sets the peers PROXY headers are accepted from. Other
+// peers are refused in strict mode, and in optional mode are served as
+// direct clients unless they send a header.
+func WithTrustedProxies(trusted TrustedProxies) Option {
+	return func(o *options) {
+		o.trustedProxies = trusted
+	}
+}
+
+// WithRateLimiter limits how often each client address may connect. The
+// limiter may be shared between servers.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(o *options) {
+		o.rateLimiter = limiter
+	}
+}
+
+// WithConnLimiter caps concurrent connections. Sharing one limiter between
+// servers makes the cap global.
+func WithConnLimiter(limiter *ConnLimiter) Option {
+	return func(o *options) {
+		o.connLimiter = limiter
+	}
+}
+
+// WithWriteTimeout bounds how long writing a response may take, so slow
+// readers can't hold connections open indefinitely
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithRequestTimeout makes the TCP server wait up to timeout for an optional
+// request line from the client before serving it. A zero timeout serves
+// immediately without reading from the client.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// newOptions applies opts on top of the defaults
+func newOptions(opts []Option) options {
+	o := options{
+		name:   "default",
+		format: FormatITerm,
+		proxy:  ProxyOff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyMode controls whether a listener expects PROXY protocol headers
+type ProxyMode string
+
+const (
+	// ProxyOff treats the peer address as the client address
+	ProxyOff ProxyMode = "off"
+	// ProxyOptional uses the address from a PROXY header when one is sent
+	ProxyOptional ProxyMode = "optional"
+	// ProxyStrict rejects connections that don't start with a PROXY header
+	ProxyStrict ProxyMode = "strict"
+)
+
+// proxyHeaderTimeout bounds how long a client may take to send a PROXY
+// header. In optional mode, direct clients that send nothing are served
+// once it expires.
+const proxyHeaderTimeout = time.Second
+
+// proxyV1MaxLength is the longest valid version 1 header, including CRLF
+const proxyV1MaxLength = 107
+
+// proxyV2Signature starts every version 2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// errMissingProxyHeader reports a connection that didn't start with a header
+var errMissingProxyHeader = errors.New("missing proxy protocol header")
+
+// ParseProxyMode validates a PROXY protocol mode, defaulting to ProxyOff
+func ParseProxyMode(name string) (ProxyMode, error) {
+	switch m := ProxyMode(strings.ToLower(name)); m {
+	case "":
+		return ProxyOff, nil
+	case ProxyOff, ProxyOptional, ProxyStrict:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown proxy protocol mode %q", name)
+	}
+}
+
+// proxyConn is a connection whose client address came from a PROXY header
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	header bool // whether the connection started with a PROXY header
+}
+
+// Read reads from the buffered reader so bytes sent after the header are kept
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// readProxyHeader consumes a PROXY protocol v1 or v2 header and returns a
+// connection reporting the original client address. Headers for local or
+// unknown connections keep the peer address. Without a header the
+// connection is returned as is, unless strict is set.
+func readProxyHeader(conn net.Conn, strict bool, timeout time.Duration) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	pc := &proxyConn{
+		Conn:   conn,
+		reader: bufio.NewReaderSize(conn, 256),
+		remote: conn.RemoteAddr(),
+	}
+
+	var remote net.Addr
+	var err error
+	switch first, peekErr := pc.reader.Peek(1); {
+	case peekErr != nil:
+		var netErr net.Error
+		if errors.As(peekErr, &netErr) && netErr.Timeout() {
+			err = errMissingProxyHeader
+		} else {
+			return nil, fmt.Errorf("failed to read proxy header: %w", peekErr)
+		}
+	case first[0] == 'P':
+		remote, err = readProxyV1(pc.reader)
+	case first[0] == proxyV2Signature[0]:
+		remote, err = readProxyV2(pc.reader)
+	default:
+		err = errMissingProxyHeader
+	}
+
+	if errors.Is(err, errMissingProxyHeader) && !strict {
+		return pc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pc.header = true
+	if remote != nil {
+		pc.remote = remote
+	}
+	return pc, nil
+}
+
+// readProxyV1 parses a human readable version 1 header, returning a nil
+// address for UNKNOWN connections
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(6)
+	if err != nil || string(prefix) != "PROXY " {
+		return nil, errMissingProxyHeader
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > proxyV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("invalid proxy v1 header")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid proxy v1 header %q", line)
+	}
+
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy v1 source address: %w", err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy v1 source port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readProxyV2 parses a binary version 2 header, returning a nil address for
+// LOCAL connections and address families other than IPv4 and IPv6
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(proxyV2Signature))
+	if err != nil || !bytes.Equal(signature, proxyV2Signature) {
+		return nil, errMissingProxyHeader
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read proxy v2 header: %w", err)
+	}
+	if version := header[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version %d", version)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read proxy v2 addresses: %w", err)
+	}
+
+	switch command := header[12] & 0x0f; command {
+	case 0x0: // LOCAL, e.g. health checks from the proxy itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unknown proxy v2 command %d", command)
+	}
+
+	var ip netip.Addr
+	var port []byte
+	switch family := header[13] >> 4; family {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("short proxy v2 ipv4 addresses")
+		}
+		ip = netip.AddrFrom4([4]byte(payload[0:4]))
+		port = payload[8:10]
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("short proxy v2 ipv6 addresses")
+		}
+		ip = netip.AddrFrom16([16]byte(payload[0:16]))
+		port = payload[32:34]
+	default:
+		return nil, nil
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(port))), nil
+}
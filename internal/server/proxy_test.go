@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// proxyV2Header builds a version 2 header with the given command, family
+// and address payload
+func proxyV2Header(command, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4 := []byte{203, 0, 113, 7, 192, 0, 2, 1, 0xc8, 0x02, 0x10, 0x68}
+	ipv6 := make([]byte, 36)
+	copy(ipv6, net.ParseIP("2001:db8::7"))
+	copy(ipv6[16:], net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(ipv6[32:], 51234)
+
+	tests := []struct {
+		name       string
+		input      []byte
+		strict     bool
+		wantRemote string // empty keeps the peer address
+		wantRest   string
+		wantErr    bool
+	}{
+		{
+			name:       "v1 tcp4",
+			input:      []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51202 4200\r\nclient=laptop\n"),
+			strict:     true,
+			wantRemote: "203.0.113.7:51202",
+			wantRest:   "client=laptop\n",
+		},
+		{
+			name:       "v1 tcp6",
+			input:      []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 4200\r\n"),
+			strict:     true,
+			wantRemote: "[2001:db8::7]:51234",
+		},
+		{
+			name:   "v1 unknown",
+			input:  []byte("PROXY UNKNOWN\r\n"),
+			strict: true,
+		},
+		{
+			name:    "v1 invalid address",
+			input:   []byte("PROXY TCP4 laptop 192.0.2.1 51202 4200\r\n"),
+			wantErr: true,
+		},
+		{
+			name:    "v1 missing crlf",
+			input:   []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51202 4200\n"),
+			wantErr: true,
+		},
+		{
+			name:       "v2 tcp4",
+			input:      append(proxyV2Header(0x1, 0x11, ipv4), "client=laptop\n"...),
+			strict:     true,
+			wantRemote: "203.0.113.7:51202",
+			wantRest:   "client=laptop\n",
+		},
+		{
+			name:       "v2 tcp6",
+			input:      proxyV2Header(0x1, 0x21, ipv6),
+			strict:     true,
+			wantRemote: "[2001:db8::7]:51234",
+		},
+		{
+			name:   "v2 local",
+			input:  proxyV2Header(0x0, 0x00, nil),
+			strict: true,
+		},
+		{
+			name:    "v2 short addresses",
+			input:   proxyV2Header(0x1, 0x11, ipv4[:6]),
+			wantErr: true,
+		},
+		{
+			name:    "v2 unknown command",
+			input:   proxyV2Header(0x2, 0x11, ipv4),
+			wantErr: true,
+		},
+		{
+			name:     "no header optional",
+			input:    []byte("client=laptop\n"),
+			wantRest: "client=laptop\n",
+		},
+		{
+			name:    "no header strict",
+			input:   []byte("client=laptop\n"),
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name: "silent client optional",
+		},
+		{
+			name:    "silent client strict",
+			strict:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+
+			go func() {
+				client.Write(tt.input)
+				time.Sleep(100 * time.Millisecond)
+				client.Close()
+			}()
+
+			conn, err := readProxyHeader(server, tt.strict, 50*time.Millisecond)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			wantRemote := tt.wantRemote
+			if wantRemote == "" {
+				wantRemote = server.RemoteAddr().String()
+			}
+			if got := conn.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("expected remote %s, got %s", wantRemote, got)
+			}
+
+			rest, _ := io.ReadAll(conn)
+			if string(rest) != tt.wantRest {
+				t.Errorf("expected remaining data %q, got %q", tt.wantRest, rest)
+			}
+		})
+	}
+}
+
+func TestParseProxyMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    ProxyMode
+		wantErr bool
+	}{
+		{name: "", want: ProxyOff},
+		{name: "off", want: ProxyOff},
+		{name: "Optional", want: ProxyOptional},
+		{name: "strict", want: ProxyStrict},
+		{name: "always", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProxyMode(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProxyMode(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseProxyMode(%q) = %s, want %s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTCPServer_ProxyProtocolACL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	acl, err := ParseACL(nil, []string{"203.0.113.7"})
+	if err != nil {
+		t.Fatalf("failed to parse acl: %v", err)
+	}
+	port := freePort(t)
+
+	trusted, err := ParseTrustedProxies([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithACL(acl), WithProxyProtocol(ProxyStrict), WithTrustedProxies(trusted))
+	go server.Start()
+	defer server.Stop(context.Background())
+
+	request := func(header string) string {
+		t.Helper()
+		var conn net.Conn
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port))); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(header))
+		response, _ := io.ReadAll(conn)
+		return string(response)
+	}
+
+	// The proxy itself is on loopback, so only the header decides access
+	if response := request("PROXY TCP4 203.0.113.7 127.0.0.1 51202 4200\r\n"); response != "" {
+		t.Errorf("expected no content for denied client, got %s", response)
+	}
+	if response := request("PROXY TCP4 198.51.100.1 127.0.0.1 51202 4200\r\n"); response != "test data" {
+		t.Errorf("expected test data for allowed client, got %s", response)
+	}
+
+	if stats := server.Stats(); stats.Denied != 1 || stats.Accepted != 1 {
+		t.Errorf("expected 1 denied and 1 accepted, got %+v", stats)
+	}
+}
+
+func TestTCPServer_ProxyProtocolUntrusted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	acl, err := ParseACL([]string{"198.51.100.0/24"}, nil)
+	if err != nil {
+		t.Fatalf("failed to parse acl: %v", err)
+	}
+	// Loopback, where the test connects from, is not a trusted proxy
+	trusted, err := ParseTrustedProxies([]string{"192.0.2.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	for _, mode := range []ProxyMode{ProxyStrict, ProxyOptional} {
+		t.Run(string(mode), func(t *testing.T) {
+			port := freePort(t)
+			server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithACL(acl), WithProxyProtocol(mode), WithTrustedProxies(trusted))
+			go server.Start()
+			defer server.Stop(context.Background())
+
+			var conn net.Conn
+			for i := 0; i < 50; i++ {
+				if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port))); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+
+			// The header names an allowed client, but can't be trusted
+			conn.Write([]byte("PROXY TCP4 198.51.100.1 127.0.0.1 51202 4200\r\n"))
+			if response, _ := io.ReadAll(conn); len(response) != 0 {
+				t.Errorf("expected no content for spoofed header, got %s", response)
+			}
+			if stats := server.Stats(); stats.Denied != 1 || stats.Accepted != 0 {
+				t.Errorf("expected 1 denied and none accepted, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_Trusts(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		addr net.Addr
+		want bool
+	}{
+		{addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}, want: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1")}, want: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.2")}, want: false},
+		{addr: &net.UnixAddr{Name: "@", Net: "unix"}, want: true},
+		{addr: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := trusted.Trusts(tt.addr); got != tt.want {
+			t.Errorf("Trusts(%v) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	if (TrustedProxies{}).Trusts(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}) {
+		t.Error("expected an empty list to trust no TCP peers")
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// maxRequestLine bounds the size of the optional request line
+const maxRequestLine = 1024
+
+// request describes what a client asked for
+type request struct {
+	// clientID identifies the client for no-repeat rotation
+	clientID string
+	// scope restricts the tags and sources the client wants
+	scope cache.Scope
+}
+
+// parseRequest parses a request line in URL query form, e.g.
+// "client=laptop&tag=cats&source=xkcd"
+func parseRequest(line string) (request, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(line))
+	if err != nil {
+		return request{}, fmt.Errorf("invalid request line: %w", err)
+	}
+
+	return request{
+		clientID: values.Get("client"),
+		scope:    ParseScope(values),
+	}, nil
+}
+
+// ParseScope reads the "tag" and "source" parameters into a scope. Both
+// may be repeated or comma separated.
+func ParseScope(values url.Values) cache.Scope {
+	return cache.Scope{
+		Tags:    splitValues(values["tag"]),
+		Sources: splitValues(values["source"]),
+	}
+}
+
+// splitValues flattens repeated and comma separated values
+func splitValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// readRequest waits up to timeout for a request line from the client.
+// Clients that send nothing get an empty request once the timeout expires.
+func readRequest(conn net.Conn, timeout time.Duration) (request, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return request{}, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	reader := bufio.NewReaderSize(conn, maxRequestLine)
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return request{}, fmt.Errorf("request line exceeds %d bytes", maxRequestLine)
+	}
+
+	// A missing or unterminated line is fine: most clients never send one
+	return parseRequest(string(line))
+}
+
+// clientName returns the client ID or host a clientKey was built from, as
+// shown to the client in captions
+func clientName(key string) string {
+	if name, ok := strings.CutPrefix(key, "id:"); ok {
+		return name
+	}
+	return strings.TrimPrefix(key, "addr:")
+}
+
+// clientKey identifies a client by its supplied ID, falling back to the
+// host part of its remote address
+func clientKey(clientID string, remoteAddr string) string {
+	if clientID != "" {
+		return "id:" + clientID
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return "addr:" + remoteAddr
+	}
+	return "addr:" + host
+}
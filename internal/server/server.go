@@ -1,72 +1,346 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/stevielcb/motd-server/internal/services"
 )
 
-// TCPServer represents a TCP server that serves cached content
+// handshakeTimeout bounds how long a client may take to complete a TLS handshake
+const handshakeTimeout = 10 * time.Second
+
+// rejectTimeout bounds how long writing a rejection message may take
+const rejectTimeout = time.Second
+
+// Temporary accept errors, such as running out of file descriptors, are
+// retried with a delay doubling from minAcceptDelay up to maxAcceptDelay
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// TCPServer represents a stream server that serves cached content over TCP
+// or a Unix socket
 type TCPServer struct {
 	host     string
 	port     int
 	cache    services.CacheManager
 	logger   *slog.Logger
+	opts     options
+	counters counters
+
+	// tlsConfig is applied per connection, after any PROXY header is read
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
 	listener net.Listener
+	closing  bool
+	conns    map[net.Conn]struct{}
+	inflight sync.WaitGroup
+	ready    chan struct{}
 }
 
 // NewTCPServer creates a new TCP server instance
-func NewTCPServer(host string, port int, cache services.CacheManager, logger *slog.Logger) *TCPServer {
+func NewTCPServer(host string, port int, cache services.CacheManager, logger *slog.Logger, opts ...Option) *TCPServer {
 	return &TCPServer{
 		host:   host,
 		port:   port,
 		cache:  cache,
 		logger: logger,
+		opts:   newOptions(opts),
+		conns:  make(map[net.Conn]struct{}),
+		ready:  make(chan struct{}),
 	}
 }
 
 // Start begins listening for connections
 func (s *TCPServer) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.host, s.port)
-	l, err := net.Listen("tcp", addr)
+	var l net.Listener
+	var err error
+	switch {
+	case s.opts.listener != nil:
+		l = s.opts.listener
+		addr = l.Addr().String()
+	case s.opts.socketPath != "":
+		addr = s.opts.socketPath
+		l, err = listenUnix(s.opts.socketPath, s.opts.socketMode, s.opts.socketOwner)
+	default:
+		l, err = net.Listen("tcp", addr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
+	if s.opts.tls != nil {
+		tlsConfig, err := newTLSConfig(*s.opts.tls, s.logger)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		s.tlsConfig = tlsConfig
+	}
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
 	s.listener = l
-	s.logger.Info("server started", "address", addr)
+	s.mu.Unlock()
+	close(s.ready)
 
+	s.logger.Info("server started", "name", s.opts.name, "address", addr, "tls", s.opts.tls != nil, "proxyProtocol", s.opts.proxy)
+	return s.serve(l)
+}
+
+// serve accepts connections until the listener is closed
+func (s *TCPServer) serve(l net.Listener) error {
 	defer l.Close()
+	var delay time.Duration
 	for {
 		conn, err := l.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.logger.Info("server stopped", "name", s.opts.name)
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+				s.logger.Warn("temporary error accepting connection, retrying", "name", s.opts.name, "error", err, "delay", delay)
+				time.Sleep(delay)
+				continue
+			}
 			s.logger.Error("failed to accept connection", "error", err)
 			return fmt.Errorf("failed to accept connection: %w", err)
 		}
-		go s.handleRequest(conn)
+		delay = 0
+
+		// Unless a trusted proxy may send a header, the peer address is
+		// final, so denied clients can be dropped before a goroutine is spent
+		// on them
+		if !s.fromTrustedProxy(conn) && !s.allowed(conn) {
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.untrack(conn)
+			s.serveConn(conn)
+		}()
 	}
 }
 
-// Stop gracefully stops the server
-func (s *TCPServer) Stop() error {
+// Ready is closed once the server is listening
+func (s *TCPServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Stats returns the server's connection counters
+func (s *TCPServer) Stats() Stats {
+	return s.counters.snapshot()
+}
+
+// Stop stops accepting connections and waits for in-flight responses to
+// finish. Connections still open when ctx is done are closed forcibly.
+func (s *TCPServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	var err error
 	if s.listener != nil {
-		return s.listener.Close()
+		err = s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		s.logger.Warn("closing active connections", "name", s.opts.name, "count", len(s.conns))
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to drain connections: %w", ctx.Err())
+	}
+}
+
+// track registers an active connection, reporting false if the server is
+// shutting down
+func (s *TCPServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.inflight.Add(1)
+	return true
+}
+
+// untrack forgets a connection once it has been handled
+func (s *TCPServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.inflight.Done()
+}
+
+// allowed checks a connection against the ACL, closing it if denied
+func (s *TCPServer) allowed(conn net.Conn) bool {
+	if !s.opts.acl.Allows(conn.RemoteAddr()) {
+		s.counters.denied.Add(1)
+		s.logger.Warn("connection denied by acl", "name", s.opts.name, "remote", conn.RemoteAddr().String())
+		conn.Close()
+		return false
+	}
+	return true
+}
+
+// fromTrustedProxy reports whether the connection may carry a PROXY header
+func (s *TCPServer) fromTrustedProxy(conn net.Conn) bool {
+	return s.opts.proxy != ProxyOff && s.opts.trustedProxies.Trusts(conn.RemoteAddr())
+}
+
+// serveConn resolves the client address and applies the access control, rate
+// and concurrency limits before handling a connection
+func (s *TCPServer) serveConn(conn net.Conn) {
+	switch {
+	case s.fromTrustedProxy(conn):
+		proxied, err := readProxyHeader(conn, s.opts.proxy == ProxyStrict, proxyHeaderTimeout)
+		if err != nil {
+			s.counters.denied.Add(1)
+			s.logger.Warn("rejecting connection with invalid proxy header", "name", s.opts.name, "remote", conn.RemoteAddr().String(), "error", err)
+			conn.Close()
+			return
+		}
+		conn = proxied
+
+		if !s.allowed(conn) {
+			return
+		}
+	case s.opts.proxy == ProxyStrict:
+		s.counters.denied.Add(1)
+		s.logger.Warn("rejecting connection from untrusted proxy", "name", s.opts.name, "remote", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	case s.opts.proxy == ProxyOptional:
+		// Direct clients are served, but must not claim another address
+		direct, err := readProxyHeader(conn, false, proxyHeaderTimeout)
+		if pc, ok := direct.(*proxyConn); err != nil || (ok && pc.header) {
+			s.counters.denied.Add(1)
+			s.logger.Warn("rejecting proxy header from untrusted peer", "name", s.opts.name, "remote", conn.RemoteAddr().String())
+			conn.Close()
+			return
+		}
+		conn = direct
+	}
+	s.counters.accepted.Add(1)
+
+	remote := conn.RemoteAddr().String()
+
+	if !s.opts.rateLimiter.Allow(clientKey("", remote)) {
+		s.counters.rateLimited.Add(1)
+		s.logger.Warn("connection rate limited", "name", s.opts.name, "remote", remote)
+		s.reject(conn)
+		return
+	}
+
+	if !s.opts.connLimiter.Acquire() {
+		s.counters.rejected.Add(1)
+		s.logger.Warn("too many connections, rejecting", "name", s.opts.name, "remote", remote)
+		s.reject(conn)
+		return
+	}
+	defer s.opts.connLimiter.Release()
+
+	if s.tlsConfig != nil {
+		conn = tls.Server(conn, s.tlsConfig)
+	}
+	s.handleRequest(conn)
+}
+
+// reject politely turns a client away without letting it hold the connection
+// open. TLS clients are only disconnected: the message would arrive before
+// the handshake, and completing one costs the resources being protected.
+func (s *TCPServer) reject(conn net.Conn) {
+	defer conn.Close()
+
+	if s.tlsConfig != nil {
+		return
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(rejectTimeout)); err != nil {
+		return
 	}
-	return nil
+	conn.Write([]byte(busyMessage))
 }
 
 // handleRequest handles an individual client connection
 func (s *TCPServer) handleRequest(conn net.Conn) {
 	defer conn.Close()
 
-	data, err := s.cache.GetRandomFile()
+	// Complete the TLS handshake up front so failures are logged clearly and
+	// verified client certificates can identify the client
+	var certClientID string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			s.logger.Warn("tls handshake failed", "remote", conn.RemoteAddr().String(), "error", err)
+			return
+		}
+		if certs := tlsConn.ConnectionState().VerifiedChains; len(certs) > 0 {
+			certClientID = certs[0][0].Subject.CommonName
+		}
+	}
+
+	var req request
+	if s.opts.requestTimeout > 0 {
+		var err error
+		req, err = readRequest(conn, s.opts.requestTimeout)
+		if err != nil {
+			s.logger.Warn("ignoring invalid request", "remote", conn.RemoteAddr().String(), "error", err)
+		}
+	}
+
+	if req.clientID == "" {
+		req.clientID = certClientID
+	}
+	client := clientKey(req.clientID, conn.RemoteAddr().String())
+	data, err := selectFor(s.cache, s.opts, client, req.scope)
 	if err != nil {
 		s.logger.Error("failed to get random file", "error", err)
 		return
 	}
 
+	if s.opts.writeTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(s.opts.writeTimeout)); err != nil {
+			s.logger.Error("failed to set write deadline", "error", err)
+			return
+		}
+	}
+
 	if _, err := conn.Write(data); err != nil {
 		s.logger.Error("failed to write to connection", "error", err)
 	}
@@ -1,18 +1,34 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/rotation"
+	"github.com/stevielcb/motd-server/internal/schedule"
 )
 
 // Mock cache manager for testing
 type mockCacheManager struct {
 	shouldError bool
 	returnData  []byte
+	lastQuery   cache.Query
+	// block, when set, holds Select until it is closed
+	block chan struct{}
 }
 
 func (m *mockCacheManager) WriteToCache(url string, msg string) error {
@@ -29,6 +45,21 @@ func (m *mockCacheManager) GetRandomFile() ([]byte, error) {
 	return m.returnData, nil
 }
 
+func (m *mockCacheManager) WriteItem(url string, meta cache.Metadata) error {
+	return m.WriteToCache(url, meta.Message)
+}
+
+func (m *mockCacheManager) Select(q cache.Query) (cache.Item, []byte, error) {
+	if m.block != nil {
+		<-m.block
+	}
+	m.lastQuery = q
+	if m.shouldError {
+		return cache.Item{}, nil, fmt.Errorf("mock select error")
+	}
+	return cache.Item{ID: "mock-id"}, m.returnData, nil
+}
+
 func (m *mockCacheManager) Cleanup() error {
 	if m.shouldError {
 		return fmt.Errorf("mock cleanup error")
@@ -77,7 +108,7 @@ func TestTCPServer_Start(t *testing.T) {
 	}
 
 	// Test that server can be stopped even if not started
-	if err := server.Stop(); err != nil {
+	if err := server.Stop(context.Background()); err != nil {
 		t.Errorf("failed to stop server: %v", err)
 	}
 }
@@ -103,7 +134,7 @@ func TestTCPServer_Stop(t *testing.T) {
 	server := NewTCPServer("localhost", 8080, cacheManager, logger)
 
 	// Test stopping server that hasn't been started
-	err := server.Stop()
+	err := server.Stop(context.Background())
 	if err != nil {
 		t.Errorf("unexpected error when stopping unstarted server: %v", err)
 	}
@@ -187,3 +218,590 @@ func TestTCPServer_HandleRequest_WriteError(t *testing.T) {
 	// Handle request - should not panic
 	server.handleRequest(serverConn)
 }
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected request
+	}{
+		{
+			name:     "empty line",
+			line:     "",
+			expected: request{},
+		},
+		{
+			name:     "client id",
+			line:     "client=laptop\r\n",
+			expected: request{clientID: "laptop"},
+		},
+		{
+			name: "tags and sources",
+			line: "tag=cats,dogs&tag=birds&source=giphy\n",
+			expected: request{scope: cache.Scope{
+				Tags:    []string{"cats", "dogs", "birds"},
+				Sources: []string{"giphy"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseRequest(tt.line)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(req, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, req)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	if got := clientKey("laptop", "10.0.0.1:1234"); got != "id:laptop" {
+		t.Errorf("expected supplied ID to win, got %s", got)
+	}
+	if got := clientKey("", "10.0.0.1:1234"); got != "addr:10.0.0.1" {
+		t.Errorf("expected remote host, got %s", got)
+	}
+}
+
+func TestTCPServer_HandleRequest_RequestLine(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	history, err := rotation.NewHistory(5, time.Hour, "")
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+
+	server := NewTCPServer("localhost", 8080, cacheManager, logger,
+		WithHistory(history), WithRequestTimeout(time.Second))
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.handleRequest(serverConn)
+
+	if _, err := clientConn.Write([]byte("client=laptop\n")); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+
+	response, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if string(response) != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+
+	if !history.Recent("id:laptop")["mock-id"] {
+		t.Error("expected served item to be recorded against the client ID")
+	}
+}
+
+func TestHTTPServer_HandleMOTD(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	history, err := rotation.NewHistory(5, time.Hour, "")
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+
+	server := NewHTTPServer("localhost", 0, cacheManager, logger, WithHistory(history))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ClientHeader, "laptop")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "test data" {
+		t.Errorf("expected test data, got %s", rec.Body.String())
+	}
+	if !history.Recent("id:laptop")["mock-id"] {
+		t.Error("expected served item to be recorded against the client header")
+	}
+}
+
+func TestHTTPServer_HandleMOTD_Scope(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+
+	server := NewHTTPServer("localhost", 0, cacheManager, logger,
+		WithScope(cache.Scope{Sources: []string{"giphy"}}))
+
+	tests := []struct {
+		name     string
+		target   string
+		expected cache.Scope
+	}{
+		{
+			name:     "server default scope",
+			target:   "/",
+			expected: cache.Scope{Sources: []string{"giphy"}},
+		},
+		{
+			name:     "requested scope",
+			target:   "/?tag=cats&source=xkcd",
+			expected: cache.Scope{Tags: []string{"cats"}, Sources: []string{"xkcd"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if !reflect.DeepEqual(cacheManager.lastQuery.Scope, tt.expected) {
+				t.Errorf("expected scope %+v, got %+v", tt.expected, cacheManager.lastQuery.Scope)
+			}
+		})
+	}
+}
+
+func TestSelectFor_Schedule(t *testing.T) {
+	cacheManager := &mockCacheManager{returnData: []byte("test data")}
+	sched, err := schedule.New(config.Rules{{
+		Name:      "office",
+		Hours:     "09:00-17:00",
+		MaxRating: "g",
+		Tags:      []string{"work"},
+		Weights:   map[string]float64{"xkcd": 1},
+	}}, time.UTC, func() time.Time { return time.Date(2025, 6, 6, 10, 0, 0, 0, time.UTC) })
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		scope     cache.Scope
+		wantScope cache.Scope
+		wantMax   string
+	}{
+		{
+			name:      "rule tags and rating",
+			opts:      []Option{WithSchedule(sched), WithPolicy(cache.Policy{MaxRating: "pg"})},
+			wantScope: cache.Scope{Tags: []string{"work"}},
+			wantMax:   "g",
+		},
+		{
+			name:      "stricter listener rating",
+			opts:      []Option{WithSchedule(sched), WithPolicy(cache.Policy{MaxRating: "y"})},
+			wantScope: cache.Scope{Tags: []string{"work"}},
+			wantMax:   "y",
+		},
+		{
+			name:      "listener scope over rule tags",
+			opts:      []Option{WithSchedule(sched), WithScope(cache.Scope{Sources: []string{"giphy"}})},
+			wantScope: cache.Scope{Sources: []string{"giphy"}},
+			wantMax:   "g",
+		},
+		{
+			name:      "requested scope over rule tags",
+			opts:      []Option{WithSchedule(sched)},
+			scope:     cache.Scope{Tags: []string{"cats"}},
+			wantScope: cache.Scope{Tags: []string{"cats"}},
+			wantMax:   "g",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := selectFor(cacheManager, newOptions(tt.opts), "client", tt.scope); err != nil {
+				t.Fatalf("selectFor() error = %v", err)
+			}
+			q := cacheManager.lastQuery
+			if !reflect.DeepEqual(q.Scope, tt.wantScope) {
+				t.Errorf("scope = %+v, want %+v", q.Scope, tt.wantScope)
+			}
+			if q.Policy.MaxRating != tt.wantMax {
+				t.Errorf("max rating = %q, want %q", q.Policy.MaxRating, tt.wantMax)
+			}
+			if q.Weights.Groups["xkcd"] != 1 {
+				t.Errorf("expected rule weights, got %v", q.Weights.Groups)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  Format
+		expectErr bool
+	}{
+		{name: "", expected: FormatITerm},
+		{name: "TEXT", expected: FormatText},
+		{name: "json", expected: FormatJSON},
+		{name: "sixel", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormat(tt.name)
+			if tt.expectErr && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if format != tt.expected {
+				t.Errorf("expected format %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	item := cache.Item{ID: "abc", Metadata: cache.Metadata{
+		Provider: "xkcd",
+		URL:      "https://example.com/xkcd.png",
+		Message:  "alt text",
+	}}
+	data := []byte("1337;File=inline=1")
+
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{format: FormatITerm, expected: "1337;File=inline=1"},
+		{format: FormatText, expected: "alt text\nhttps://example.com/xkcd.png\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			out, err := render(tt.format, item, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+
+	out, err := render(FormatJSON, item, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded cache.Item
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("failed to decode JSON output: %v", err)
+	}
+	if decoded.ID != "abc" || decoded.Provider != "xkcd" {
+		t.Errorf("unexpected JSON output %s", out)
+	}
+}
+
+func TestTCPServer_HandleRequest_Policy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	policy := cache.Policy{Scope: cache.Scope{Sources: []string{"xkcd"}}, MaxRating: "g"}
+
+	server := NewTCPServer("localhost", 8080, cacheManager, logger, WithPolicy(policy), WithFormat(FormatText))
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.handleRequest(serverConn)
+
+	if _, err := io.ReadAll(clientConn); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if !reflect.DeepEqual(cacheManager.lastQuery.Policy, policy) {
+		t.Errorf("expected policy %+v, got %+v", policy, cacheManager.lastQuery.Policy)
+	}
+}
+
+func TestTCPServer_UnixSocket(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	socketPath := filepath.Join(t.TempDir(), "motd.sock")
+
+	server := NewTCPServer("", 0, cacheManager, logger, WithUnixSocket(socketPath, 0660, ""))
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect to socket: %v", err)
+	}
+
+	response, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if string(response) != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("expected socket mode 0660, got %o", info.Mode().Perm())
+	}
+
+	if err := server.Stop(context.Background()); err != nil {
+		t.Errorf("failed to stop server: %v", err)
+	}
+	<-errChan
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Error("expected socket file to be removed on stop")
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// A regular file must never be removed
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := removeStaleSocket(regular); err == nil {
+		t.Error("expected error for non-socket path but got none")
+	}
+
+	// A socket nobody listens on is stale
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("expected stale socket to be removed")
+	}
+
+	// A socket in use is left alone
+	inUse := filepath.Join(dir, "in-use.sock")
+	l, err = net.Listen("unix", inUse)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	if err := removeStaleSocket(inUse); err == nil {
+		t.Error("expected error for socket in use but got none")
+	}
+}
+
+func TestLookupOwner(t *testing.T) {
+	tests := []struct {
+		owner       string
+		expectedUID int
+		expectedGID int
+	}{
+		{owner: "1000", expectedUID: 1000, expectedGID: -1},
+		{owner: "1000:1001", expectedUID: 1000, expectedGID: 1001},
+		{owner: ":1001", expectedUID: -1, expectedGID: 1001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			uid, gid, err := lookupOwner(tt.owner)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if uid != tt.expectedUID || gid != tt.expectedGID {
+				t.Errorf("expected %d:%d, got %d:%d", tt.expectedUID, tt.expectedGID, uid, gid)
+			}
+		})
+	}
+
+	if _, _, err := lookupOwner("no-such-user-motd"); err == nil {
+		t.Error("expected error for unknown user but got none")
+	}
+}
+
+// flakyListener fails with a temporary error before handing out conns and
+// reports itself closed once they run out
+type flakyListener struct {
+	net.Listener
+	failures int
+	conns    []net.Conn
+}
+
+// temporaryError is a net.Error that should be retried
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+	if len(l.conns) == 0 {
+		return nil, net.ErrClosed
+	}
+	conn := l.conns[0]
+	l.conns = l.conns[1:]
+	return conn, nil
+}
+
+func (l *flakyListener) Close() error { return nil }
+
+func TestTCPServer_Serve_TemporaryErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+
+	server := NewTCPServer("localhost", 0, cacheManager, logger)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.serve(&flakyListener{failures: 3, conns: []net.Conn{serverConn}})
+	}()
+
+	response, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if string(response) != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+
+	// A closed listener is a clean shutdown rather than an error
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("expected nil error on close, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after listener closed")
+	}
+}
+
+// startBlocked starts a server whose cache blocks and returns a client
+// connection that is waiting on a response
+func startBlocked(t *testing.T, cacheManager *mockCacheManager) (*TCPServer, net.Conn, chan error) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	port := freePort(t)
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port))); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	for i := 0; i < 50 && server.Stats().Accepted == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return server, conn, errChan
+}
+
+func TestTCPServer_Stop_Drains(t *testing.T) {
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+		block:      make(chan struct{}),
+	}
+	server, conn, errChan := startBlocked(t, cacheManager)
+	defer conn.Close()
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- server.Stop(ctx)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("expected stop to wait for the in-flight response")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(cacheManager.block)
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if string(response) != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("failed to stop server: %v", err)
+	}
+	if err := <-errChan; err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+}
+
+func TestTCPServer_Stop_Deadline(t *testing.T) {
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+		block:      make(chan struct{}),
+	}
+	server, conn, _ := startBlocked(t, cacheManager)
+	defer conn.Close()
+	defer close(cacheManager.block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := server.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	// The connection was closed forcibly, so the client gets nothing
+	response, _ := io.ReadAll(conn)
+	if len(response) > 0 {
+		t.Errorf("expected no content after forced close, got %s", response)
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import "sync/atomic"
+
+// Stats counts connection outcomes for a server
+type Stats struct {
+	Accepted    uint64 `json:"accepted"`
+	Denied      uint64 `json:"denied"`
+	RateLimited uint64 `json:"rate_limited"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+// counters holds the live values behind Stats
+type counters struct {
+	accepted    atomic.Uint64
+	denied      atomic.Uint64
+	rateLimited atomic.Uint64
+	rejected    atomic.Uint64
+}
+
+// snapshot returns the current counter values
+func (c *counters) snapshot() Stats {
+	return Stats{
+		Accepted:    c.accepted.Load(),
+		Denied:      c.denied.Load(),
+		RateLimited: c.rateLimited.Load(),
+		Rejected:    c.rejected.Load(),
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA is a throwaway certificate authority for offline TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA creates a self-signed CA
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "motd test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue creates a certificate signed by the CA and returns it PEM encoded
+// along with its key
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to a file in dir and returns its path
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// freePort returns a TCP port that is currently free on localhost
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestTCPServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "motd-server", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "laptop", 3, x509.ExtKeyUsageClientAuth)
+
+	tlsConfig := TLSConfig{
+		CertFile:     writeFile(t, dir, "server.crt", serverCert),
+		KeyFile:      writeFile(t, dir, "server.key", serverKey),
+		ClientCAFile: writeFile(t, dir, "ca.crt", ca.pem),
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	port := freePort(t)
+
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithTLS(tlsConfig))
+	go server.Start()
+	defer server.Stop(context.Background())
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+
+	var conn *tls.Conn
+	for i := 0; i < 50; i++ {
+		conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{pair}})
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect with client certificate: %v", err)
+	}
+
+	response, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if string(response) != "test data" {
+		t.Errorf("expected test data, got %s", response)
+	}
+
+	// Without a client certificate the server must not send any content
+	conn, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: roots})
+	if err == nil {
+		response, _ = io.ReadAll(conn)
+		conn.Close()
+		if len(response) > 0 {
+			t.Error("expected no content without a client certificate")
+		}
+	}
+}
+
+func TestTCPServer_TLSRejectsWithoutPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "motd-server", 2, x509.ExtKeyUsageServerAuth)
+	tlsConfig := TLSConfig{
+		CertFile: writeFile(t, dir, "server.crt", serverCert),
+		KeyFile:  writeFile(t, dir, "server.key", serverKey),
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cacheManager := &mockCacheManager{
+		returnData: []byte("test data"),
+	}
+	port := freePort(t)
+
+	server := NewTCPServer("127.0.0.1", port, cacheManager, logger, WithTLS(tlsConfig), WithRateLimiter(NewRateLimiter(0.001, 1)))
+	go server.Start()
+	defer server.Stop(context.Background())
+
+	dial := func() net.Conn {
+		t.Helper()
+		var conn net.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port))); err == nil {
+				return conn
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("failed to connect: %v", err)
+		return nil
+	}
+
+	// The first connection uses up the burst
+	dial().Close()
+	for i := 0; i < 50 && server.Stats().Accepted == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A rejected TLS client must not be sent the plaintext busy message
+	conn := dial()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if response, err := io.ReadAll(conn); len(response) != 0 || err != nil {
+		t.Errorf("expected connection to be closed without data, got %q (%v)", response, err)
+	}
+	if stats := server.Stats(); stats.RateLimited != 1 {
+		t.Errorf("expected 1 rate limited connection, got %+v", stats)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+
+	certPEM, keyPEM := ca.issue(t, "first", 2, x509.ExtKeyUsageServerAuth)
+	certFile := writeFile(t, dir, "server.crt", certPEM)
+	keyFile := writeFile(t, dir, "server.key", keyPEM)
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	reloader, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatalf("failed to create reloader: %v", err)
+	}
+
+	commonName := func() string {
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("failed to get certificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("failed to parse certificate: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if cn := commonName(); cn != "first" {
+		t.Errorf("expected first certificate, got %s", cn)
+	}
+
+	// Rotate the pair and make sure the change is visible to the reloader
+	certPEM, keyPEM = ca.issue(t, "second", 3, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "server.crt", certPEM)
+	writeFile(t, dir, "server.key", keyPEM)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	if cn := commonName(); cn != "second" {
+		t.Errorf("expected reloaded certificate, got %s", cn)
+	}
+
+	// A broken pair keeps the previous certificate in service
+	writeFile(t, dir, "server.key", []byte("garbage"))
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	if cn := commonName(); cn != "second" {
+		t.Errorf("expected previous certificate to be kept, got %s", cn)
+	}
+
+	// The failure is logged, but not on every handshake
+	commonName()
+	if n := strings.Count(logs.String(), "failed to reload TLS certificate"); n != 1 {
+		t.Errorf("expected one reload failure logged, got %d:\n%s", n, logs.String())
+	}
+}
+
+func TestNewTLSConfig_InvalidFiles(t *testing.T) {
+	if _, err := newTLSConfig(TLSConfig{CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"}, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Error("expected error for missing certificate but got none")
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket left
+// behind by an unclean shutdown, and applies the configured mode and owner
+func listenUnix(path string, mode os.FileMode, owner string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to set socket mode: %w", err)
+		}
+	}
+
+	if owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to set socket owner: %w", err)
+		}
+	}
+
+	return l, nil
+}
+
+// removeStaleSocket removes a socket at path that nothing is listening on.
+// It refuses to remove other kinds of files or sockets still in use.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat socket path: %w", err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("socket path %s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// lookupOwner resolves an owner in "user", "user:group", ":group" form,
+// where each part is a name or a numeric ID. Omitted parts are left
+// unchanged (-1).
+func lookupOwner(owner string) (int, int, error) {
+	userPart, groupPart, _ := strings.Cut(owner, ":")
+	uid, gid := -1, -1
+
+	if userPart != "" {
+		id, err := strconv.Atoi(userPart)
+		if err != nil {
+			u, err := user.Lookup(userPart)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to look up socket owner: %w", err)
+			}
+			if id, err = strconv.Atoi(u.Uid); err != nil {
+				return 0, 0, fmt.Errorf("unsupported uid %q: %w", u.Uid, err)
+			}
+		}
+		uid = id
+	}
+
+	if groupPart != "" {
+		id, err := strconv.Atoi(groupPart)
+		if err != nil {
+			g, err := user.LookupGroup(groupPart)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to look up socket group: %w", err)
+			}
+			if id, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, fmt.Errorf("unsupported gid %q: %w", g.Gid, err)
+			}
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
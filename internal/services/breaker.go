@@ -0,0 +1,61 @@
+package services
+
+import "time"
+
+// Circuit breaker settings shared by all providers
+const (
+	breakerThreshold = 5               // consecutive failures before opening
+	breakerCooldown  = 5 * time.Minute // how long to stay open before retrying
+)
+
+// Breaker states reported in ProviderState
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker stops calling a provider that keeps failing, trying it again once
+// the cooldown has passed
+type breaker struct {
+	failures    int
+	openedAt    time.Time
+	lastErr     error
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// state returns the breaker state at now
+func (b *breaker) state(now time.Time) string {
+	switch {
+	case b.failures < breakerThreshold:
+		return BreakerClosed
+	case now.Sub(b.openedAt) < breakerCooldown:
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// allow reports whether the provider may be called at now
+func (b *breaker) allow(now time.Time) bool {
+	return b.state(now) != BreakerOpen
+}
+
+// record updates the breaker with the outcome of a call
+func (b *breaker) record(err error, now time.Time) {
+	if err == nil {
+		b.failures = 0
+		b.lastErr = nil
+		b.lastSuccess = now
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	b.lastFailure = now
+	if b.failures >= breakerThreshold {
+		// Failing again while half-open restarts the cooldown
+		b.openedAt = now
+	}
+}
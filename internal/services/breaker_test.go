@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &breaker{}
+	failure := errors.New("boom")
+
+	for range breakerThreshold - 1 {
+		b.record(failure, now)
+	}
+	if got := b.state(now); got != BreakerClosed {
+		t.Fatalf("state = %s, want %s", got, BreakerClosed)
+	}
+
+	b.record(failure, now)
+	if got := b.state(now); got != BreakerOpen || b.allow(now) {
+		t.Fatalf("state = %s, want %s", got, BreakerOpen)
+	}
+
+	later := now.Add(breakerCooldown)
+	if got := b.state(later); got != BreakerHalfOpen || !b.allow(later) {
+		t.Fatalf("state = %s, want %s", got, BreakerHalfOpen)
+	}
+
+	// Failing while half-open reopens the breaker for another cooldown
+	b.record(failure, later)
+	if got := b.state(later.Add(time.Second)); got != BreakerOpen {
+		t.Fatalf("state = %s, want %s", got, BreakerOpen)
+	}
+
+	b.record(nil, later.Add(breakerCooldown))
+	if got := b.state(later.Add(breakerCooldown)); got != BreakerClosed || b.failures != 0 || b.lastErr != nil {
+		t.Fatalf("state = %s after success, want %s", got, BreakerClosed)
+	}
+}
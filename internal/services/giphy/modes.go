@@ -0,0 +1,115 @@
+package giphy
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+
+	"github.com/stevielcb/motd-server/internal/cache"
+)
+
+// Ways of choosing a GIF for a tag
+const (
+	ModeRandom    = "random"    // a random GIF with the tag
+	ModeSearch    = "search"    // the next result searching for the tag
+	ModeTrending  = "trending"  // the next trending GIF, the tag is only a label
+	ModeTranslate = "translate" // the GIF Giphy translates the tag, a phrase, to
+)
+
+// Modes lists the valid modes
+var Modes = []string{ModeRandom, ModeSearch, ModeTrending, ModeTranslate}
+
+// maxOffset is the furthest Giphy pages into search results
+const maxOffset = 4999
+
+// Get fetches a Giphy URL for the tag and rating using mode, which defaults
+// to ModeRandom
+func (s *Service) Get(mode, tag, rating string) (string, error) {
+	switch mode {
+	case "", ModeRandom:
+		return s.GetRandom(tag, rating)
+	case ModeSearch:
+		return s.next("search", url.Values{"q": {tag}, "rating": {rating}})
+	case ModeTrending:
+		return s.next("trending", url.Values{"rating": {rating}})
+	case ModeTranslate:
+		return s.translate(tag, rating)
+	default:
+		return "", fmt.Errorf("unknown giphy mode %q", mode)
+	}
+}
+
+// next fetches the next result from a search or trending endpoint, walking
+// through the results one call at a time and starting over at the end
+func (s *Service) next(endpoint string, query url.Values) (string, error) {
+	key := endpoint + "?" + query.Encode()
+	s.mu.Lock()
+	offset := s.offsets[key]
+	s.mu.Unlock()
+
+	params := url.Values{"limit": {"1"}, "offset": {fmt.Sprint(offset)}}
+	maps.Copy(params, query)
+	resp, err := s.get(endpoint, params)
+	if err != nil {
+		return "", err
+	}
+	gifs, err := list(resp.Data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(gifs) == 0 && offset > 0 {
+		// The results shrank under us, so go back to the start
+		s.setOffset(key, 0)
+		return s.next(endpoint, query)
+	}
+	if len(gifs) == 0 {
+		return "", fmt.Errorf("%w for %s %q", ErrNoResults, endpoint, query.Get("q"))
+	}
+
+	offset++
+	if offset >= resp.Pagination.TotalCount || offset > maxOffset {
+		offset = 0
+	}
+	s.setOffset(key, offset)
+
+	return s.pick(gifs[0])
+}
+
+// setOffset records the next result to fetch for a query
+func (s *Service) setOffset(key string, offset int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets[key] = offset
+}
+
+// translate fetches the GIF Giphy picks for a phrase. The endpoint doesn't
+// filter by rating, so results rated above rating are rejected.
+func (s *Service) translate(phrase, rating string) (string, error) {
+	resp, err := s.get("translate", url.Values{"s": {phrase}})
+	if err != nil {
+		return "", err
+	}
+
+	g, ok, err := single(resp.Data)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w for phrase %q", ErrNoResults, phrase)
+	}
+
+	if rating != "" {
+		// Giphy items without a rating are treated as rated "r"
+		got := g.Rating
+		if got == "" {
+			got = "r"
+		}
+		if !strings.EqualFold(cache.StricterRating(got, rating), got) {
+			return "", fmt.Errorf("giphy translation of %q is rated %s, above %s", phrase, got, rating)
+		}
+	}
+
+	return s.pick(g)
+}
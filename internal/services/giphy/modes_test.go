@@ -0,0 +1,144 @@
+package giphy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// result is a GIF in a test response
+func result(id, rating string) string {
+	return fmt.Sprintf(`{"id":%q,"rating":%q,"images":{"original":{"url":"https://media.giphy.com/%s.gif","size":"10"}}}`, id, rating, id)
+}
+
+// newModesAPI stands in for Giphy's search, trending and translate endpoints.
+// Search and trending have total results, one per offset, and translate
+// returns a GIF with the translated rating, or nothing if that is "none".
+func newModesAPI(t *testing.T, total int, translated string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/search", "/trending":
+			if r.URL.Path == "/search" && query.Get("q") != "deploy" {
+				t.Errorf("unexpected search query %q", query.Get("q"))
+			}
+			if query.Get("limit") != "1" || query.Get("rating") != "g" {
+				t.Errorf("unexpected request %s", r.URL)
+			}
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			data := "[]"
+			if offset < total {
+				data = "[" + result(fmt.Sprintf("%s-%d", r.URL.Path[1:], offset), "g") + "]"
+			}
+			fmt.Fprintf(w, `{"data":%s,"pagination":{"total_count":%d,"count":1,"offset":%d},"meta":{"status":200}}`, data, total, offset)
+		case "/translate":
+			if query.Get("s") != "ship it" {
+				t.Errorf("unexpected translate phrase %q", query.Get("s"))
+			}
+			if translated == "none" {
+				io.WriteString(w, `{"data":[],"meta":{"status":200}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"data":%s,"meta":{"status":200}}`, result("translated", translated))
+		case "/random":
+			fmt.Fprintf(w, `{"data":%s,"meta":{"status":200}}`, result("random", "g"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestService_Get_Paging(t *testing.T) {
+	tests := []struct {
+		mode string
+		tag  string
+		want []string
+	}{
+		{mode: ModeSearch, tag: "deploy", want: []string{"search-0", "search-1", "search-2", "search-0"}},
+		{mode: ModeTrending, tag: "trending", want: []string{"trending-0", "trending-1", "trending-2", "trending-0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			service := newTestService(t, "", 1000)
+			service.baseURL = newModesAPI(t, 3, "none").URL
+
+			for i, id := range tt.want {
+				got, err := service.Get(tt.mode, tt.tag, "g")
+				if err != nil {
+					t.Fatalf("call %d: unexpected error: %v", i, err)
+				}
+				if want := "https://media.giphy.com/" + id + ".gif"; got != want {
+					t.Errorf("call %d: expected %q, got %q", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestService_Get_ResultsShrink(t *testing.T) {
+	service := newTestService(t, "", 1000)
+	service.baseURL = newModesAPI(t, 2, "none").URL
+
+	// Pretend an earlier walk got further than the results now go
+	service.offsets["search?q=deploy&rating=g"] = 5
+
+	got, err := service.Get(ModeSearch, "deploy", "g")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "https://media.giphy.com/search-0.gif" {
+		t.Errorf("expected to start over, got %q", got)
+	}
+}
+
+func TestService_Get_Modes(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		tag        string
+		rating     string
+		total      int
+		translated string
+		want       string
+		wantErr    error
+	}{
+		{name: "default is random", tag: "cats", rating: "g", want: "https://media.giphy.com/random.gif"},
+		{name: "random", mode: ModeRandom, tag: "cats", rating: "g", want: "https://media.giphy.com/random.gif"},
+		{name: "translate", mode: ModeTranslate, tag: "ship it", rating: "pg", translated: "g", want: "https://media.giphy.com/translated.gif"},
+		{name: "translate without rating", mode: ModeTranslate, tag: "ship it", translated: "r", want: "https://media.giphy.com/translated.gif"},
+		{name: "translate rated too high", mode: ModeTranslate, tag: "ship it", rating: "g", translated: "pg-13", wantErr: errAny},
+		{name: "translate unrated", mode: ModeTranslate, tag: "ship it", rating: "pg-13", wantErr: errAny},
+		{name: "translate no result", mode: ModeTranslate, tag: "ship it", rating: "g", translated: "none", wantErr: ErrNoResults},
+		{name: "search no results", mode: ModeSearch, tag: "deploy", rating: "g", wantErr: ErrNoResults},
+		{name: "unknown mode", mode: "bogus", tag: "cats", rating: "g", wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, "", 1000)
+			service.baseURL = newModesAPI(t, tt.total, tt.translated).URL
+
+			got, err := service.Get(tt.mode, tt.tag, tt.rating)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("expected error but got none")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package giphy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// response is the envelope around every Giphy API response
+type response struct {
+	Data       json.RawMessage `json:"data"`
+	Meta       meta            `json:"meta"`
+	Pagination pagination      `json:"pagination"`
+}
+
+// pagination locates a page of search or trending results
+type pagination struct {
+	TotalCount int `json:"total_count"`
+	Count      int `json:"count"`
+	Offset     int `json:"offset"`
+}
+
+// meta reports the outcome of a Giphy API call
+type meta struct {
+	Status     int    `json:"status"`
+	Message    string `json:"msg"`
+	ResponseID string `json:"response_id"`
+}
+
+// gif is a single result from the Giphy API
+type gif struct {
+	ID     string               `json:"id"`
+	Title  string               `json:"title"`
+	URL    string               `json:"url"`
+	Rating string               `json:"rating"`
+	Images map[string]rendition `json:"images"`
+}
+
+// rendition is one of the versions Giphy serves of a GIF, such as
+// "original" or "fixed_width". Giphy reports sizes as strings.
+type rendition struct {
+	URL      string `json:"url"`
+	Width    string `json:"width"`
+	Height   string `json:"height"`
+	Size     string `json:"size"`
+	WebP     string `json:"webp"`
+	WebPSize string `json:"webp_size"`
+}
+
+// size returns the size in bytes of the GIF, or 0 if Giphy didn't report it
+func (r rendition) size() int64 {
+	n, _ := strconv.ParseInt(r.Size, 10, 64)
+	return n
+}
+
+// webpSize returns the size in bytes of the WebP, or 0 if Giphy didn't
+// report it
+func (r rendition) webpSize() int64 {
+	n, _ := strconv.ParseInt(r.WebPSize, 10, 64)
+	return n
+}
+
+// single decodes data holding one GIF. Giphy returns an empty array rather
+// than an object when nothing matched.
+func single(data json.RawMessage) (gif, bool, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return gif{}, false, nil
+	}
+
+	var g gif
+	if err := json.Unmarshal(data, &g); err != nil {
+		return gif{}, false, fmt.Errorf("failed to unmarshal giphy result: %w", err)
+	}
+	return g, true, nil
+}
+
+// list decodes data holding a page of GIFs
+func list(data json.RawMessage) ([]gif, error) {
+	var gifs []gif
+	if err := json.Unmarshal(data, &gifs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal giphy results: %w", err)
+	}
+	return gifs, nil
+}
@@ -2,111 +2,224 @@ package giphy
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevielcb/motd-server/internal/secret"
+)
+
+// Giphy API errors
+var (
+	ErrInvalidKey  = errors.New("invalid giphy API key")
+	ErrRateLimited = errors.New("giphy rate limit exceeded")
+	ErrNoResults   = errors.New("no giphy results")
+)
+
+const (
+	defaultBaseURL = "https://api.giphy.com/v1/gifs"
+	requestTimeout = 30 * time.Second
+	maxResponse    = 1 << 20 // API responses are a few kilobytes
 )
 
+// Renditions lists the versions of a GIF the service can fetch. "still" is a
+// static frame, for clients that can't animate.
+var Renditions = []string{"original", "downsized", "fixed_width", "fixed_height", "webp", "still"}
+
+// Options configures a Service
+type Options struct {
+	APIKey      *secret.Secret // re-read as it changes
+	APIKeyFile  string         // used if APIKey is nil
+	MaxFileSize int64          // larger renditions fall back to smaller ones
+	Rendition   string         // one of Renditions, defaults to "original"
+
+	BaseURL string       // defaults to Giphy's v1 GIFs API
+	Client  *http.Client // defaults to a client with a 30 second timeout
+}
+
 // Service handles Giphy API interactions
 type Service struct {
-	apiKey      string
+	apiKey      *secret.Secret
 	maxFileSize int64
+	rendition   string
+	baseURL     string
+	client      *http.Client
 	logger      *slog.Logger
+
+	mu      sync.Mutex
+	offsets map[string]int // next result to fetch by search or trending query
 }
 
 // NewService creates a new Giphy service
-func NewService(apiKeyFile string, maxFileSize int64, logger *slog.Logger) (*Service, error) {
-	dat, err := os.ReadFile(apiKeyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read giphy API key file: %w", err)
+func NewService(opts Options, logger *slog.Logger) (*Service, error) {
+	rendition := opts.Rendition
+	if rendition == "" {
+		rendition = "original"
+	}
+	if !slices.Contains(Renditions, rendition) {
+		return nil, fmt.Errorf("unknown giphy rendition %q", rendition)
+	}
+
+	apiKey := opts.APIKey
+	if apiKey == nil {
+		apiKey = secret.New("", opts.APIKeyFile, "")
+	}
+	if _, err := apiKey.Get(); err != nil {
+		return nil, fmt.Errorf("failed to read giphy API key: %w", err)
+	}
+
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
 	}
 
 	return &Service{
-		apiKey:      string(dat),
-		maxFileSize: maxFileSize,
+		apiKey:      apiKey,
+		maxFileSize: opts.MaxFileSize,
+		rendition:   rendition,
+		baseURL:     baseURL,
+		client:      client,
 		logger:      logger,
+		offsets:     make(map[string]int),
 	}, nil
 }
 
 // GetRandom fetches a random Giphy URL matching the given tag and rating
 func (s *Service) GetRandom(tag string, rating string) (string, error) {
-	url := fmt.Sprintf(
-		"http://api.giphy.com/v1/gifs/random?api_key=%s&tag=%s&rating=%s",
-		s.apiKey,
-		url.QueryEscape(tag),
-		rating,
-	)
-
-	resp, err := http.Get(url)
+	resp, err := s.get("random", url.Values{"tag": {tag}, "rating": {rating}})
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch giphy API: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	g, ok, err := single(resp.Data)
 	if err != nil {
-		return "", fmt.Errorf("failed to read giphy API response: %w", err)
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w for tag %q", ErrNoResults, tag)
 	}
 
-	var result map[string]any
-	err = json.Unmarshal(body, &result)
+	return s.pick(g)
+}
+
+// get calls a Giphy API endpoint and returns the response, turning HTTP and
+// Giphy errors into Go errors
+func (s *Service) get(endpoint string, params url.Values) (response, error) {
+	apiKey, err := s.apiKey.Get()
 	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal giphy API response: %w", err)
+		return response{}, fmt.Errorf("failed to read giphy API key: %w", err)
 	}
+	params.Set("api_key", apiKey)
+	endpointURL := s.baseURL + "/" + endpoint
 
-	data, ok := result["data"].(map[string]any)
-	if !ok || data == nil {
-		return "", fmt.Errorf("no data in giphy API response")
+	resp, err := s.client.Get(endpointURL + "?" + params.Encode())
+	if err != nil {
+		// Keep the API key out of logged errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = endpointURL
+		}
+		return response{}, fmt.Errorf("failed to fetch giphy API: %w", err)
 	}
+	defer resp.Body.Close()
 
-	images, ok := data["images"].(map[string]any)
-	if !ok || images == nil {
-		return "", fmt.Errorf("no images data in giphy API response")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return response{}, fmt.Errorf("failed to read giphy API response: %w", err)
 	}
 
-	original, ok := images["original"].(map[string]any)
-	if !ok || original == nil {
-		return "", fmt.Errorf("no original image data in giphy API response")
-	}
+	var result response
+	decodeErr := json.Unmarshal(body, &result)
 
-	downsized, ok := images["downsized_large"].(map[string]any)
-	if !ok || downsized == nil {
-		return "", fmt.Errorf("no downsized image data in giphy API response")
+	status := resp.StatusCode
+	if status == http.StatusOK && result.Meta.Status != 0 {
+		status = result.Meta.Status
 	}
-
-	originalURL, ok := original["url"].(string)
-	if !ok || originalURL == "" {
-		return "", fmt.Errorf("no original image URL in giphy API response")
+	if status != http.StatusOK {
+		message := result.Meta.Message
+		if message == "" {
+			message = http.StatusText(status)
+		}
+		switch status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return response{}, fmt.Errorf("%w: %s", ErrInvalidKey, message)
+		case http.StatusTooManyRequests:
+			return response{}, fmt.Errorf("%w: %s", ErrRateLimited, message)
+		default:
+			return response{}, fmt.Errorf("giphy API returned status %d: %s", status, message)
+		}
 	}
-
-	sizeResp, err := http.Head(originalURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to check original image size: %w", err)
+	if decodeErr != nil {
+		return response{}, fmt.Errorf("failed to unmarshal giphy API response: %w", decodeErr)
 	}
 
-	if sizeResp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to check image size, status: %d", sizeResp.StatusCode)
-	}
+	return result, nil
+}
 
-	sizeStr := sizeResp.Header.Get("Content-Length")
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse content length: %w", err)
+// pick returns the URL of the configured rendition of g, falling back to
+// smaller versions when Giphy reports it is larger than the maximum file size
+func (s *Service) pick(g gif) (string, error) {
+	var found bool
+	for _, c := range candidates(g.Images, s.rendition) {
+		if c.url == "" {
+			continue
+		}
+		found = true
+		if c.size == 0 || c.size <= s.maxFileSize {
+			s.logger.Debug("fetched giphy", "id", g.ID, "title", g.Title, "rendition", s.rendition, "url", c.url)
+			return c.url, nil
+		}
 	}
 
-	// If the original gif is larger than MaxFileSizeMB, get the downsized image instead
-	downsizedURL, ok := downsized["url"].(string)
-	if !ok || downsizedURL == "" {
-		return "", fmt.Errorf("no downsized image URL in giphy API response")
+	if !found {
+		return "", fmt.Errorf("no %s image in giphy response for %s", s.rendition, g.ID)
 	}
+	return "", fmt.Errorf("every %s image of giphy %s is larger than %d bytes", s.rendition, g.ID, s.maxFileSize)
+}
+
+// candidate is an image URL and its size as reported by Giphy
+type candidate struct {
+	url  string
+	size int64
+}
 
-	if int64(size) > s.maxFileSize {
-		return downsizedURL, nil
+// candidates returns the images for a rendition in order of preference
+func candidates(images map[string]rendition, name string) []candidate {
+	gifs := func(names ...string) []candidate {
+		var cs []candidate
+		for _, n := range names {
+			cs = append(cs, candidate{images[n].URL, images[n].size()})
+		}
+		return cs
 	}
 
-	return originalURL, nil
+	switch name {
+	case "downsized":
+		return gifs("downsized_large", "downsized", "downsized_medium")
+	case "fixed_width":
+		return gifs("fixed_width", "fixed_width_downsampled", "fixed_width_small")
+	case "fixed_height":
+		return gifs("fixed_height", "fixed_height_downsampled", "fixed_height_small")
+	case "webp":
+		var cs []candidate
+		for _, n := range []string{"original", "fixed_width", "fixed_height"} {
+			cs = append(cs, candidate{images[n].WebP, images[n].webpSize()})
+		}
+		return cs
+	case "still":
+		return gifs("original_still", "downsized_still", "fixed_width_still")
+	default:
+		return gifs("original", "downsized_large", "downsized")
+	}
 }
@@ -1,9 +1,15 @@
 package giphy
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -39,7 +45,7 @@ func TestNewService(t *testing.T) {
 			}
 
 			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-			service, err := NewService(tt.apiKeyFile, 10*1024*1024, logger) // 10MB default
+			service, err := NewService(Options{APIKeyFile: tt.apiKeyFile, MaxFileSize: 10 * 1024 * 1024}, logger) // 10MB default
 
 			if tt.expectErr && err == nil {
 				t.Error("expected error but got none")
@@ -50,8 +56,10 @@ func TestNewService(t *testing.T) {
 			if !tt.expectErr && service == nil {
 				t.Error("expected service but got nil")
 			}
-			if !tt.expectErr && service.apiKey != tt.apiKey {
-				t.Errorf("expected API key %s, got %s", tt.apiKey, service.apiKey)
+			if !tt.expectErr {
+				if apiKey, _ := service.apiKey.Get(); apiKey != tt.apiKey {
+					t.Errorf("expected API key %s, got %s", tt.apiKey, apiKey)
+				}
 			}
 		})
 	}
@@ -67,7 +75,7 @@ func TestService_GetRandom(t *testing.T) {
 	defer os.Remove(apiKeyFile)
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service, err := NewService(apiKeyFile, 10*1024*1024, logger) // 10MB default
+	service, err := NewService(Options{APIKeyFile: apiKeyFile, MaxFileSize: 10 * 1024 * 1024}, logger) // 10MB default
 	if err != nil {
 		t.Fatalf("failed to create service: %v", err)
 	}
@@ -125,7 +133,7 @@ func TestService_GetRandom_InvalidAPIKey(t *testing.T) {
 	defer os.Remove(apiKeyFile)
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service, err := NewService(apiKeyFile, 10*1024*1024, logger) // 10MB default
+	service, err := NewService(Options{APIKeyFile: apiKeyFile, MaxFileSize: 10 * 1024 * 1024}, logger) // 10MB default
 	if err != nil {
 		t.Fatalf("failed to create service: %v", err)
 	}
@@ -136,3 +144,123 @@ func TestService_GetRandom_InvalidAPIKey(t *testing.T) {
 		t.Error("expected error with invalid API key but got none")
 	}
 }
+
+// testGIF is a random endpoint response with an original GIF of the given
+// size and a smaller downsized one
+func testGIF(originalSize int) string {
+	return fmt.Sprintf(`{"data":{"id":"abc","title":"Cat GIF","images":{
+		"original":{"url":"https://media.giphy.com/original.gif","size":"%d","webp":"https://media.giphy.com/original.webp","webp_size":"100"},
+		"downsized_large":{"url":"https://media.giphy.com/downsized.gif","size":"500"},
+		"fixed_width":{"url":"https://media.giphy.com/200w.gif","size":"300"},
+		"original_still":{"url":"https://media.giphy.com/still.gif","size":"50"}
+	}},"meta":{"status":200,"msg":"OK"}}`, originalSize)
+}
+
+func TestService_GetRandom_Responses(t *testing.T) {
+	tests := []struct {
+		name      string
+		rendition string
+		status    int
+		body      string
+		want      string
+		wantErr   error
+	}{
+		{name: "original", status: http.StatusOK, body: testGIF(1000), want: "https://media.giphy.com/original.gif"},
+		{name: "original too large", status: http.StatusOK, body: testGIF(5000), want: "https://media.giphy.com/downsized.gif"},
+		{name: "fixed width", rendition: "fixed_width", status: http.StatusOK, body: testGIF(1000), want: "https://media.giphy.com/200w.gif"},
+		{name: "webp", rendition: "webp", status: http.StatusOK, body: testGIF(1000), want: "https://media.giphy.com/original.webp"},
+		{name: "still", rendition: "still", status: http.StatusOK, body: testGIF(1000), want: "https://media.giphy.com/still.gif"},
+		{name: "missing rendition", rendition: "fixed_height", status: http.StatusOK, body: testGIF(1000), wantErr: errAny},
+		{name: "no results", status: http.StatusOK, body: `{"data":[],"meta":{"status":200,"msg":"OK"}}`, wantErr: ErrNoResults},
+		{name: "invalid key", status: http.StatusUnauthorized, body: `{"meta":{"status":401,"msg":"Unauthorized"}}`, wantErr: ErrInvalidKey},
+		{name: "banned key in meta", status: http.StatusOK, body: `{"data":[],"meta":{"status":403,"msg":"Forbidden"}}`, wantErr: ErrInvalidKey},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{"message":"API rate limit exceeded"}`, wantErr: ErrRateLimited},
+		{name: "server error", status: http.StatusBadGateway, body: "<html>bad gateway</html>", wantErr: errAny},
+		{name: "malformed", status: http.StatusOK, body: "{", wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if r.URL.Path != "/random" || query.Get("api_key") != "secret-key" || query.Get("tag") != "cats & dogs" || query.Get("rating") != "g" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			service := newTestService(t, tt.rendition, 1000)
+			service.baseURL = server.URL
+
+			got, err := service.GetRandom("cats & dogs", "g")
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("expected error but got none")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if err != nil && strings.Contains(err.Error(), "secret-key") {
+				t.Errorf("error leaks the API key: %v", err)
+			}
+		})
+	}
+}
+
+func TestService_GetRandom_RedactsKey(t *testing.T) {
+	service := newTestService(t, "", 1000)
+	service.baseURL = "http://127.0.0.1:0"
+
+	_, err := service.GetRandom("cats", "g")
+	if err == nil {
+		t.Fatal("expected error but got none")
+	}
+	if strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("error leaks the API key: %v", err)
+	}
+}
+
+func TestNewService_Rendition(t *testing.T) {
+	apiKeyFile := filepath.Join(t.TempDir(), "giphy-api")
+	if err := os.WriteFile(apiKeyFile, []byte("secret-key"), 0600); err != nil {
+		t.Fatalf("failed to create test API key file: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if _, err := NewService(Options{APIKeyFile: apiKeyFile, Rendition: "mp4"}, logger); err == nil {
+		t.Error("expected error for unknown rendition")
+	}
+	service, err := NewService(Options{APIKeyFile: apiKeyFile}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if service.rendition != "original" {
+		t.Errorf("expected original rendition by default, got %q", service.rendition)
+	}
+}
+
+// errAny matches any error in table tests
+var errAny = errors.New("any error")
+
+// newTestService creates a service with the key "secret-key"
+func newTestService(t *testing.T, rendition string, maxFileSize int64) *Service {
+	t.Helper()
+
+	apiKeyFile := filepath.Join(t.TempDir(), "giphy-api")
+	if err := os.WriteFile(apiKeyFile, []byte("secret-key"), 0600); err != nil {
+		t.Fatalf("failed to create test API key file: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service, err := NewService(Options{APIKeyFile: apiKeyFile, MaxFileSize: maxFileSize, Rendition: rendition}, logger)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return service
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"github.com/nishanths/go-xkcd/v2"
+
+	"github.com/stevielcb/motd-server/internal/cache"
 )
 
 // GiphyProvider defines the interface for Giphy service
 type GiphyProvider interface {
-	GetRandom(tag string, rating string) (string, error)
+	Get(mode, tag, rating string) (string, error)
 }
 
 // XKCDProvider defines the interface for XKCD service
@@ -17,6 +19,8 @@ type XKCDProvider interface {
 // CacheManager defines the interface for cache operations
 type CacheManager interface {
 	WriteToCache(url string, msg string) error
+	WriteItem(url string, meta cache.Metadata) error
 	GetRandomFile() ([]byte, error)
+	Select(q cache.Query) (cache.Item, []byte, error)
 	Cleanup() error
 }
@@ -1,65 +1,362 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/stevielcb/motd-server/internal/cache"
 	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/schedule"
 	"github.com/stevielcb/motd-server/internal/services/giphy"
 	"github.com/stevielcb/motd-server/internal/services/xkcd"
 )
 
+// Providers lists the content providers in the order they're fetched
+var Providers = []string{"giphy", "xkcd"}
+
+// ErrUnknownProvider is returned for a provider name not in Providers
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// ErrNotConfigured is returned when fetching from a provider that was left
+// unconfigured, such as Giphy without an API key
+var ErrNotConfigured = errors.New("provider not configured")
+
+// ProviderState describes a provider's runtime state
+type ProviderState struct {
+	Name        string    `json:"name"`
+	Configured  bool      `json:"configured"`
+	Enabled     bool      `json:"enabled"`
+	Breaker     string    `json:"breaker"`
+	Failures    int       `json:"failures"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
 // Manager coordinates all external service calls
 type Manager struct {
-	config *config.Config
-	giphy  GiphyProvider
-	xkcd   XKCDProvider
-	logger *slog.Logger
+	config   *config.Config
+	schedule *schedule.Schedule
+	giphy    GiphyProvider
+	xkcd     XKCDProvider
+	logger   *slog.Logger
+
+	mu       sync.Mutex
+	disabled map[string]bool
+	breakers map[string]*breaker
+	now      func() time.Time
 }
 
-// NewManager creates a new services manager
-func NewManager(cfg *config.Config, logger *slog.Logger) (*Manager, error) {
-	giphyService, err := giphy.NewService(cfg.GiphyApiKeyFile, cfg.MaxFileSize, logger)
-	if err != nil {
+// NewManager creates a new services manager calling providers with client.
+// The schedule's active rules add Giphy tags and cap ratings; it may be nil.
+func NewManager(cfg *config.Config, sched *schedule.Schedule, client *http.Client, logger *slog.Logger) (*Manager, error) {
+	if err := ValidateConfig(cfg); err != nil {
 		return nil, err
 	}
 
-	xkcdService := xkcd.NewService(logger)
+	// Giphy is optional: without tags or an API key it is left out rather
+	// than failing startup
+	var giphyProvider GiphyProvider
+	apiKey := cfg.GiphyKeySecret()
+	switch {
+	case !WantsGiphy(cfg):
+		logger.Info("giphy disabled, no tags configured")
+	case apiKey == nil:
+		logger.Warn("giphy disabled, no API key configured")
+	default:
+		giphyService, err := giphy.NewService(giphy.Options{
+			APIKey:      apiKey,
+			MaxFileSize: cfg.MaxFileSize,
+			Rendition:   cfg.GiphyRendition,
+			BaseURL:     cfg.GiphyBaseURL,
+			Client:      client,
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+		giphyProvider = giphyService
+		logger.Info("giphy enabled", "key", apiKey.Source())
+	}
+
+	xkcdService, err := xkcd.NewService(xkcd.Options{
+		Prefer2x:  cfg.XKCDPrefer2x,
+		LatestTTL: time.Duration(cfg.XKCDLatestTTL) * time.Second,
+		SeenFile:  cfg.XKCDSeenFile,
+		Exclude:   cfg.XKCDExclude,
+		BaseURL:   cfg.XKCDBaseURL,
+		Client:    client,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Manager{
-		config: cfg,
-		giphy:  giphyService,
-		xkcd:   xkcdService,
-		logger: logger,
+		config:   cfg,
+		schedule: sched,
+		giphy:    giphyProvider,
+		xkcd:     xkcdService,
+		logger:   logger,
 	}, nil
 }
 
-// DownloadMOTDs fetches new MOTDs from all configured services
-func (m *Manager) DownloadMOTDs(cache CacheManager) error {
-	// Download from Giphy for each configured tag
-	for tag, rating := range m.config.GiphyTags {
-		url, err := m.giphy.GetRandom(tag, rating)
+// DownloadMOTDs fetches new MOTDs from all enabled services, skipping those
+// whose circuit breaker is open
+func (m *Manager) DownloadMOTDs(cacheManager CacheManager) error {
+	for _, provider := range Providers {
+		if !m.ready(provider) {
+			continue
+		}
+
+		providerErr, cacheErr := m.fetch(cacheManager, provider)
+		m.record(provider, providerErr)
+		if cacheErr != nil {
+			return cacheErr
+		}
+		// Giphy errors are logged per tag but don't stop the process
+		if providerErr != nil && provider != "giphy" {
+			return providerErr
+		}
+	}
+	return nil
+}
+
+// Fetch downloads from a single provider now, whether or not it's enabled
+// or its breaker is open. The outcome still updates the breaker.
+func (m *Manager) Fetch(cacheManager CacheManager, provider string) error {
+	if err := checkProvider(provider); err != nil {
+		return err
+	}
+	if !m.configured(provider) {
+		return fmt.Errorf("%w: %s", ErrNotConfigured, provider)
+	}
+
+	providerErr, cacheErr := m.fetch(cacheManager, provider)
+	m.record(provider, providerErr)
+	return errors.Join(providerErr, cacheErr)
+}
+
+// fetch downloads from one provider, returning the provider's and the
+// cache's failures separately so only the former trip the breaker
+func (m *Manager) fetch(cacheManager CacheManager, provider string) (error, error) {
+	switch provider {
+	case "giphy":
+		return m.fetchGiphy(cacheManager)
+	default:
+		return m.fetchXKCD(cacheManager)
+	}
+}
+
+// giphyTags returns the Giphy tags to fetch and their ratings, adjusted by
+// the active schedule rules
+func (m *Manager) giphyTags() map[string]string {
+	effect := m.schedule.Active()
+	if len(effect.Rules) == 0 {
+		return m.config.GiphyTags
+	}
+
+	tags := make(map[string]string, len(m.config.GiphyTags)+len(effect.GiphyTags))
+	for _, source := range []map[string]string{m.config.GiphyTags, effect.GiphyTags} {
+		for tag, rating := range source {
+			if rating == "" {
+				rating = effect.MaxRating
+			}
+			tags[tag] = cache.StricterRating(rating, effect.MaxRating)
+		}
+	}
+	m.logger.Debug("applying schedule rules to giphy tags", "rules", effect.Rules, "tags", tags)
+	return tags
+}
+
+// fetchGiphy downloads one GIF per tag. It only reports a provider failure
+// if every tag failed.
+func (m *Manager) fetchGiphy(cacheManager CacheManager) (error, error) {
+	tags := m.giphyTags()
+	var errs []error
+	for tag, rating := range tags {
+		mode := m.config.GiphyModes[tag]
+		url, err := m.giphy.Get(mode, tag, rating)
 		if err != nil {
-			m.logger.Error("failed to fetch giphy", "tag", tag, "rating", rating, "error", err)
+			m.logger.Error("failed to fetch giphy", "tag", tag, "rating", rating, "mode", mode, "error", err)
+			errs = append(errs, err)
 			continue
 		}
 
-		if err := cache.WriteToCache(url, ""); err != nil {
+		if err := cacheManager.WriteItem(url, cache.Metadata{Provider: "giphy", Tag: tag, Rating: rating}); errors.Is(err, cache.ErrBanned) {
+			m.logger.Info("skipping banned giphy", "tag", tag, "error", err)
+			continue
+		} else if err != nil {
 			m.logger.Error("failed to cache giphy", "url", url, "error", err)
-			return err
+			return nil, err
 		}
 	}
 
-	// Download from XKCD
+	if len(errs) > 0 && len(errs) == len(tags) {
+		return errors.Join(errs...), nil
+	}
+	return nil, nil
+}
+
+// fetchXKCD downloads a random XKCD comic
+func (m *Manager) fetchXKCD(cacheManager CacheManager) (error, error) {
 	comic, err := m.xkcd.GetRandom()
 	if err != nil {
 		m.logger.Error("failed to fetch xkcd comic", "error", err)
-		return err
+		return err, nil
 	}
 
-	if err := cache.WriteToCache(comic.ImageURL, comic.Alt); err != nil {
+	meta := cache.Metadata{
+		Provider:  "xkcd",
+		Title:     comic.Title,
+		Message:   xkcd.Caption(comic, m.config.XKCDTranscript),
+		Number:    comic.Number,
+		Published: xkcd.Published(comic),
+		Permalink: xkcd.Permalink(comic.Number),
+	}
+	if m.config.XKCDTranscript {
+		meta.Transcript = comic.Transcript
+	}
+	if err := cacheManager.WriteItem(comic.ImageURL, meta); errors.Is(err, cache.ErrBanned) {
+		m.logger.Info("skipping banned xkcd comic", "error", err)
+	} else if err != nil {
 		m.logger.Error("failed to cache xkcd", "url", comic.ImageURL, "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// SetEnabled turns scheduled downloads from a provider on or off
+func (m *Manager) SetEnabled(provider string, enabled bool) error {
+	if err := checkProvider(provider); err != nil {
 		return err
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disabled == nil {
+		m.disabled = make(map[string]bool)
+	}
+	m.disabled[provider] = !enabled
+	m.logger.Info("provider updated", "provider", provider, "enabled", enabled)
 	return nil
 }
+
+// Providers returns the runtime state of every provider
+func (m *Manager) Providers() []ProviderState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock()
+	states := make([]ProviderState, 0, len(Providers))
+	for _, provider := range Providers {
+		b := m.breaker(provider)
+		state := ProviderState{
+			Name:        provider,
+			Configured:  m.configured(provider),
+			Enabled:     !m.disabled[provider],
+			Breaker:     b.state(now),
+			Failures:    b.failures,
+			LastSuccess: b.lastSuccess,
+			LastFailure: b.lastFailure,
+		}
+		if b.lastErr != nil {
+			state.LastError = b.lastErr.Error()
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// ready reports whether a scheduled download may call the provider
+func (m *Manager) ready(provider string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.disabled[provider] || !m.configured(provider) {
+		return false
+	}
+	if !m.breaker(provider).allow(m.clock()) {
+		m.logger.Debug("skipping provider with open breaker", "provider", provider)
+		return false
+	}
+	return true
+}
+
+// record updates a provider's breaker with the outcome of a fetch
+func (m *Manager) record(provider string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.breaker(provider)
+	before := b.state(m.clock())
+	b.record(err, m.clock())
+	if after := b.state(m.clock()); after != before {
+		m.logger.Warn("provider breaker changed state", "provider", provider, "from", before, "to", after)
+	}
+}
+
+// breaker returns a provider's breaker, creating it if needed. m.mu must
+// be held.
+func (m *Manager) breaker(provider string) *breaker {
+	if m.breakers == nil {
+		m.breakers = make(map[string]*breaker)
+	}
+	b, ok := m.breakers[provider]
+	if !ok {
+		b = &breaker{}
+		m.breakers[provider] = b
+	}
+	return b
+}
+
+// clock returns the current time
+func (m *Manager) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+// configured reports whether the provider was set up
+func (m *Manager) configured(provider string) bool {
+	if provider == "giphy" {
+		return m.giphy != nil
+	}
+	return m.xkcd != nil
+}
+
+// ValidateConfig checks the provider settings NewManager would reject,
+// without reading secrets
+func ValidateConfig(cfg *config.Config) error {
+	for tag, mode := range cfg.GiphyModes {
+		if !slices.Contains(giphy.Modes, mode) {
+			return fmt.Errorf("invalid giphy mode %q for tag %q", mode, tag)
+		}
+	}
+	if cfg.GiphyRendition != "" && WantsGiphy(cfg) && cfg.GiphyKeySecret() != nil &&
+		!slices.Contains(giphy.Renditions, cfg.GiphyRendition) {
+		return fmt.Errorf("unknown giphy rendition %q", cfg.GiphyRendition)
+	}
+	return nil
+}
+
+// WantsGiphy reports whether any Giphy tags are configured, directly or by
+// schedule rules
+func WantsGiphy(cfg *config.Config) bool {
+	if len(cfg.GiphyTags) > 0 {
+		return true
+	}
+	return slices.ContainsFunc(cfg.Rules, func(r config.Rule) bool { return len(r.GiphyTags) > 0 })
+}
+
+// checkProvider returns ErrUnknownProvider for names not in Providers
+func checkProvider(provider string) error {
+	if slices.Contains(Providers, provider) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+}
@@ -4,21 +4,35 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nishanths/go-xkcd/v2"
+	"github.com/stevielcb/motd-server/internal/cache"
 	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/httpclient"
+	"github.com/stevielcb/motd-server/internal/schedule"
 )
 
 // Mock implementations for testing
 type mockGiphyProvider struct {
 	shouldError bool
+	modes       map[string]string // the mode each tag was fetched with
 }
 
-func (m *mockGiphyProvider) GetRandom(tag string, rating string) (string, error) {
+func (m *mockGiphyProvider) Get(mode, tag, rating string) (string, error) {
 	if m.shouldError {
 		return "", errors.New("mock giphy error")
 	}
+	if m.modes != nil {
+		m.modes[tag] = mode
+	}
 	return "https://example.com/giphy.gif", nil
 }
 
@@ -31,13 +45,21 @@ func (m *mockXKCDProvider) GetRandom() (xkcd.Comic, error) {
 		return xkcd.Comic{}, errors.New("mock xkcd error")
 	}
 	return xkcd.Comic{
-		ImageURL: "https://example.com/xkcd.png",
-		Alt:      "Mock XKCD comic",
+		ImageURL:   "https://example.com/xkcd.png",
+		Alt:        "Mock XKCD comic",
+		Number:     42,
+		Title:      "Mock",
+		Transcript: "[[A mock comic]]",
+		Year:       2024,
+		Month:      3,
+		Day:        7,
 	}, nil
 }
 
 type mockCacheManager struct {
 	writeError bool
+	banned     bool
+	written    []cache.Metadata
 }
 
 func (m *mockCacheManager) WriteToCache(url string, msg string) error {
@@ -51,6 +73,18 @@ func (m *mockCacheManager) GetRandomFile() ([]byte, error) {
 	return []byte("mock content"), nil
 }
 
+func (m *mockCacheManager) WriteItem(url string, meta cache.Metadata) error {
+	if m.banned {
+		return cache.ErrBanned
+	}
+	m.written = append(m.written, meta)
+	return m.WriteToCache(url, meta.Message)
+}
+
+func (m *mockCacheManager) Select(q cache.Query) (cache.Item, []byte, error) {
+	return cache.Item{ID: "mock-id"}, []byte("mock content"), nil
+}
+
 func (m *mockCacheManager) Cleanup() error {
 	return nil
 }
@@ -69,6 +103,7 @@ func TestManager_DownloadMOTDs(t *testing.T) {
 		giphyError    bool
 		xkcdError     bool
 		cacheError    bool
+		banned        bool
 		expectedError bool
 	}{
 		{
@@ -90,6 +125,11 @@ func TestManager_DownloadMOTDs(t *testing.T) {
 			cacheError:    true,
 			expectedError: true,
 		},
+		{
+			name:          "banned content",
+			banned:        true,
+			expectedError: false, // Banned content is skipped
+		},
 	}
 
 	for _, tt := range tests {
@@ -101,7 +141,7 @@ func TestManager_DownloadMOTDs(t *testing.T) {
 				logger: logger,
 			}
 
-			cache := &mockCacheManager{writeError: tt.cacheError}
+			cache := &mockCacheManager{writeError: tt.cacheError, banned: tt.banned}
 
 			err := manager.DownloadMOTDs(cache)
 
@@ -114,3 +154,240 @@ func TestManager_DownloadMOTDs(t *testing.T) {
 		})
 	}
 }
+
+func TestManager_ProviderControl(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	now := time.Unix(1700000000, 0)
+
+	xkcdProvider := &mockXKCDProvider{shouldError: true}
+	manager := &Manager{
+		config: &config.Config{},
+		giphy:  &mockGiphyProvider{},
+		xkcd:   xkcdProvider,
+		logger: logger,
+		now:    func() time.Time { return now },
+	}
+	cache := &mockCacheManager{}
+
+	// Enough failures open the breaker, after which xkcd is skipped
+	for range breakerThreshold {
+		if err := manager.DownloadMOTDs(cache); err == nil {
+			t.Fatal("expected error from failing xkcd")
+		}
+	}
+	if err := manager.DownloadMOTDs(cache); err != nil {
+		t.Errorf("expected open breaker to skip xkcd, got %v", err)
+	}
+	if state := manager.Providers()[1]; state.Breaker != BreakerOpen || state.Failures != breakerThreshold || state.LastError == "" {
+		t.Errorf("unexpected xkcd state %+v", state)
+	}
+
+	// A manual fetch ignores the breaker and closes it on success
+	xkcdProvider.shouldError = false
+	if err := manager.Fetch(cache, "xkcd"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if state := manager.Providers()[1]; state.Breaker != BreakerClosed || state.Failures != 0 {
+		t.Errorf("expected closed breaker, got %+v", state)
+	}
+
+	// Disabled providers are skipped by scheduled downloads
+	if err := manager.SetEnabled("xkcd", false); err != nil {
+		t.Fatalf("SetEnabled() error = %v", err)
+	}
+	xkcdProvider.shouldError = true
+	if err := manager.DownloadMOTDs(cache); err != nil {
+		t.Errorf("expected disabled xkcd to be skipped, got %v", err)
+	}
+	if manager.Providers()[1].Enabled {
+		t.Error("expected xkcd to be disabled")
+	}
+
+	if err := manager.Fetch(cache, "nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+	if err := manager.SetEnabled("nope", true); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestNewManager_BaseURLs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var userAgents []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		switch r.URL.Path {
+		case "/giphy/random":
+			io.WriteString(w, `{"data":{"id":"a","images":{"original":{"url":"https://media.example.com/a.gif","size":"10"}}},"meta":{"status":200}}`)
+		case "/xkcd/info.0.json", "/xkcd/1/info.0.json":
+			io.WriteString(w, `{"num":1,"title":"Barrel","img":"https://imgs.example.com/barrel.png","day":"1","month":"1","year":"2006"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "giphy-api")
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	cfg := &config.Config{
+		GiphyApiKeyFile: keyFile,
+		GiphyTags:       map[string]string{"cats": "g"},
+		GiphyBaseURL:    upstream.URL + "/giphy",
+		XKCDBaseURL:     upstream.URL + "/xkcd/",
+		MaxFileSize:     1000,
+		OutboundTimeout: 5,
+		UserAgent:       "motd-test",
+	}
+	client, err := httpclient.FromConfig(cfg, logger)
+	if err != nil {
+		t.Fatalf("FromConfig() error = %v", err)
+	}
+	manager, err := NewManager(cfg, nil, client, logger)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	cache := &mockCacheManager{}
+	if err := manager.DownloadMOTDs(cache); err != nil {
+		t.Fatalf("DownloadMOTDs() error = %v", err)
+	}
+	if len(cache.written) != 2 || cache.written[0].Provider != "giphy" || cache.written[1].Title != "Barrel" {
+		t.Errorf("unexpected items written: %+v", cache.written)
+	}
+	for _, ua := range userAgents {
+		if ua != "motd-test" {
+			t.Errorf("expected User-Agent motd-test, got %q", ua)
+		}
+	}
+}
+
+func TestNewManager_GiphyOptional(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name           string
+		cfg            *config.Config
+		wantConfigured bool
+	}{
+		{name: "no tags", cfg: &config.Config{GiphyApiKey: "key"}},
+		{name: "no key", cfg: &config.Config{GiphyTags: map[string]string{"cats": "g"}}},
+		{name: "key from environment", cfg: &config.Config{GiphyApiKey: "key", GiphyTags: map[string]string{"cats": "g"}}, wantConfigured: true},
+		{name: "key from command", cfg: &config.Config{GiphyApiKeyCommand: "echo key", GiphyTags: map[string]string{"cats": "g"}}, wantConfigured: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, err := NewManager(tt.cfg, nil, nil, logger)
+			if err != nil {
+				t.Fatalf("NewManager() error = %v", err)
+			}
+			if got := manager.Providers()[0]; got.Name != "giphy" || got.Configured != tt.wantConfigured {
+				t.Errorf("giphy state = %+v, want configured %v", got, tt.wantConfigured)
+			}
+			if tt.wantConfigured {
+				return
+			}
+			if err := manager.Fetch(&mockCacheManager{}, "giphy"); !errors.Is(err, ErrNotConfigured) {
+				t.Errorf("Fetch() error = %v, want ErrNotConfigured", err)
+			}
+		})
+	}
+}
+
+func TestManager_FetchGiphy_Modes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	giphyProvider := &mockGiphyProvider{modes: map[string]string{}}
+	manager := &Manager{
+		config: &config.Config{
+			GiphyTags:  map[string]string{"cats": "g", "deploy": "g", "trending": "pg"},
+			GiphyModes: map[string]string{"deploy": "search", "trending": "trending"},
+		},
+		giphy:  giphyProvider,
+		logger: logger,
+	}
+
+	if err := manager.Fetch(&mockCacheManager{}, "giphy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"cats": "", "deploy": "search", "trending": "trending"}
+	if !reflect.DeepEqual(giphyProvider.modes, want) {
+		t.Errorf("fetched with modes %v, want %v", giphyProvider.modes, want)
+	}
+}
+
+func TestManager_FetchXKCD_Metadata(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name       string
+		transcript bool
+	}{
+		{name: "without transcript"},
+		{name: "with transcript", transcript: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &Manager{
+				config: &config.Config{XKCDTranscript: tt.transcript},
+				xkcd:   &mockXKCDProvider{},
+				logger: logger,
+			}
+			cache := &mockCacheManager{}
+
+			if err := manager.Fetch(cache, "xkcd"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(cache.written) != 1 {
+				t.Fatalf("expected 1 item written, got %d", len(cache.written))
+			}
+
+			meta := cache.written[0]
+			if meta.Title != "Mock" || meta.Number != 42 || meta.Permalink != "https://xkcd.com/42/" {
+				t.Errorf("unexpected metadata: %+v", meta)
+			}
+			if !meta.Published.Equal(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("expected published 2024-03-07, got %v", meta.Published)
+			}
+			if !strings.HasPrefix(meta.Message, "Mock (#42, 2024-03-07)") {
+				t.Errorf("unexpected caption %q", meta.Message)
+			}
+			if got := strings.Contains(meta.Message, "[[A mock comic]]"); got != tt.transcript {
+				t.Errorf("transcript in caption = %v, want %v", got, tt.transcript)
+			}
+			if (meta.Transcript != "") != tt.transcript {
+				t.Errorf("unexpected transcript %q", meta.Transcript)
+			}
+		})
+	}
+}
+
+func TestManager_GiphyTags_Schedule(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	friday := time.Date(2025, 6, 6, 10, 0, 0, 0, time.UTC)
+
+	sched, err := schedule.New(config.Rules{
+		{Name: "office", Hours: "09:00-17:00", MaxRating: "g"},
+		{Name: "friday", Days: []string{"fri"}, GiphyTags: map[string]string{"friday": "pg"}},
+	}, time.UTC, func() time.Time { return friday })
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	cfg := &config.Config{GiphyTags: map[string]string{"funny": "pg-13", "cats": ""}}
+	manager := &Manager{config: cfg, schedule: sched, logger: logger}
+
+	want := map[string]string{"funny": "g", "cats": "g", "friday": "g"}
+	if got := manager.giphyTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("giphyTags() = %v, want %v", got, want)
+	}
+
+	// Without active rules the configured tags are used as they are
+	manager.schedule = nil
+	if got := manager.giphyTags(); !reflect.DeepEqual(got, cfg.GiphyTags) {
+		t.Errorf("giphyTags() = %v, want %v", got, cfg.GiphyTags)
+	}
+}
@@ -0,0 +1,174 @@
+package xkcd
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// ErrExhausted is returned when every comic is excluded or missing
+var ErrExhausted = errors.New("no xkcd comics left to fetch")
+
+// knownMissing lists comic numbers that have never existed
+var knownMissing = []int{404}
+
+// catalogueState is the part of the catalogue persisted between runs
+type catalogueState struct {
+	Seen    []int `json:"seen"`
+	Missing []int `json:"missing,omitempty"`
+}
+
+// catalogue tracks which comics have been fetched so sampling walks through
+// the archive without repeats, starting over once every comic has been seen
+type catalogue struct {
+	path    string
+	exclude map[int]bool
+
+	mu      sync.Mutex
+	seen    map[int]bool
+	missing map[int]bool
+}
+
+// newCatalogue creates a catalogue skipping the excluded comics. If path is
+// set, previously seen comics are loaded from it and changes are saved there.
+func newCatalogue(path string, exclude []int) (*catalogue, error) {
+	c := &catalogue{
+		path:    path,
+		exclude: make(map[int]bool),
+		seen:    make(map[int]bool),
+		missing: make(map[int]bool),
+	}
+	for _, n := range exclude {
+		c.exclude[n] = true
+	}
+	for _, n := range knownMissing {
+		c.missing[n] = true
+	}
+
+	if path == "" {
+		return c, nil
+	}
+
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xkcd seen file: %w", err)
+	}
+
+	var state catalogueState
+	if err := json.Unmarshal(dat, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal xkcd seen file: %w", err)
+	}
+	for _, n := range state.Seen {
+		c.seen[n] = true
+	}
+	for _, n := range state.Missing {
+		c.missing[n] = true
+	}
+
+	return c, nil
+}
+
+// next picks a random comic from 1 to latest that hasn't been seen, is not
+// excluded and is not known to be missing. Once every comic has been seen
+// the record is cleared and sampling starts over.
+func (c *catalogue) next(latest int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	candidates := c.candidates(latest)
+	if len(candidates) == 0 && len(c.seen) > 0 {
+		clear(c.seen)
+		candidates = c.candidates(latest)
+	}
+	if len(candidates) == 0 {
+		return 0, ErrExhausted
+	}
+
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate random number: %w", err)
+	}
+	return candidates[i.Int64()], nil
+}
+
+// candidates returns the comics next may pick from. The caller must hold c.mu.
+func (c *catalogue) candidates(latest int) []int {
+	var candidates []int
+	for n := 1; n <= latest; n++ {
+		if !c.seen[n] && !c.exclude[n] && !c.missing[n] {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+// markSeen records that a comic has been fetched and saves the catalogue
+func (c *catalogue) markSeen(n int) error {
+	c.mu.Lock()
+	c.seen[n] = true
+	c.mu.Unlock()
+	return c.save()
+}
+
+// markMissing records that a comic doesn't exist so it is never picked
+// again, and saves the catalogue
+func (c *catalogue) markMissing(n int) error {
+	c.mu.Lock()
+	c.missing[n] = true
+	c.mu.Unlock()
+	return c.save()
+}
+
+// remaining returns how many comics up to latest are left in this pass
+func (c *catalogue) remaining(latest int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.candidates(latest))
+}
+
+// save writes the catalogue to disk if a path is configured
+func (c *catalogue) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dat, err := json.Marshal(catalogueState{Seen: sortedKeys(c.seen), Missing: sortedKeys(c.missing)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal xkcd seen file: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := c.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create xkcd seen file directory: %w", err)
+	}
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return fmt.Errorf("failed to write xkcd seen file: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace xkcd seen file: %w", err)
+	}
+	return nil
+}
+
+// sortedKeys returns the numbers in set in ascending order
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for n := range set {
+		keys = append(keys, n)
+	}
+	slices.Sort(keys)
+	return keys
+}
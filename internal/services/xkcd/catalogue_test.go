@@ -0,0 +1,91 @@
+package xkcd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCatalogue_next(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []int
+		seen    []int
+		missing []int
+		latest  int
+		want    []int // the possible picks
+		wantErr error
+	}{
+		{name: "skips 404", latest: 405, seen: seq(1, 403), want: []int{405}},
+		{name: "skips excluded", latest: 3, exclude: []int{1, 3}, want: []int{2}},
+		{name: "skips seen", latest: 3, seen: []int{1, 2}, want: []int{3}},
+		{name: "skips missing", latest: 3, seen: []int{1}, missing: []int{2}, want: []int{3}},
+		{name: "starts over when exhausted", latest: 2, seen: []int{1}, exclude: []int{2}, want: []int{1}},
+		{name: "nothing left", latest: 2, exclude: []int{1, 2}, wantErr: ErrExhausted},
+		{name: "no comics", latest: 0, wantErr: ErrExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCatalogue("", tt.exclude)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, n := range tt.seen {
+				c.markSeen(n)
+			}
+			for _, n := range tt.missing {
+				c.markMissing(n)
+			}
+
+			got, err := c.next(tt.latest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && !slices.Contains(tt.want, got) {
+				t.Errorf("next() = %d, want one of %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogue_persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xkcd", "seen.json")
+
+	c, err := newCatalogue(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.markSeen(1); err != nil {
+		t.Fatalf("failed to mark seen: %v", err)
+	}
+	if err := c.markMissing(2); err != nil {
+		t.Fatalf("failed to mark missing: %v", err)
+	}
+
+	reloaded, err := newCatalogue(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err := reloaded.next(3); err != nil || got != 3 {
+		t.Errorf("expected comic 3 after reload, got %d (%v)", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatalf("failed to write seen file: %v", err)
+	}
+	if _, err := newCatalogue(path, nil); err == nil {
+		t.Error("expected error for corrupt seen file")
+	}
+}
+
+// seq returns the numbers from lo to hi inclusive
+func seq(lo, hi int) []int {
+	var ns []int
+	for n := lo; n <= hi; n++ {
+		ns = append(ns, n)
+	}
+	return ns
+}
@@ -2,47 +2,200 @@ package xkcd
 
 import (
 	"context"
-	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math/big"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/nishanths/go-xkcd/v2"
 )
 
+// highResTimeout bounds the check for a double resolution image
+const highResTimeout = 5 * time.Second
+
+// maxAttempts is how many comics GetRandom tries before giving up when it
+// keeps hitting missing numbers
+const maxAttempts = 3
+
+// Options configures a Service
+type Options struct {
+	Prefer2x  bool          // fetch double resolution images when available
+	LatestTTL time.Duration // how long to reuse the latest comic number, 0 to always ask
+	SeenFile  string        // where to persist the comics already fetched, optional
+	Exclude   []int         // comic numbers never to fetch
+
+	BaseURL string       // defaults to https://xkcd.com
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
 // Service handles XKCD API interactions
 type Service struct {
-	client *xkcd.Client
-	logger *slog.Logger
+	client    *xkcd.Client
+	prefer2x  bool
+	latestTTL time.Duration
+	catalogue *catalogue
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	latest   int
+	latestAt time.Time
 }
 
-// NewService creates a new XKCD service
-func NewService(logger *slog.Logger) *Service {
-	return &Service{
-		client: xkcd.NewClient(),
-		logger: logger,
+// NewService creates a new XKCD service. Comics already fetched are loaded
+// from opts.SeenFile if it exists.
+func NewService(opts Options, logger *slog.Logger) (*Service, error) {
+	catalogue, err := newCatalogue(opts.SeenFile, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	client := xkcd.NewClient()
+	if opts.BaseURL != "" {
+		client.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	}
+	if opts.Client != nil {
+		client.HTTPClient = opts.Client
 	}
+
+	return &Service{
+		client:    client,
+		prefer2x:  opts.Prefer2x,
+		latestTTL: opts.LatestTTL,
+		catalogue: catalogue,
+		logger:    logger,
+		now:       time.Now,
+	}, nil
 }
 
-// GetRandom fetches a random XKCD comic
+// GetRandom fetches a random XKCD comic that hasn't been fetched before,
+// until the whole archive has been seen and sampling starts over
 func (s *Service) GetRandom() (xkcd.Comic, error) {
+	latest, err := s.latestNumber()
+	if err != nil {
+		return xkcd.Comic{}, err
+	}
+
+	for range maxAttempts {
+		number, err := s.catalogue.next(latest)
+		if err != nil {
+			return xkcd.Comic{}, err
+		}
+
+		comic, err := s.client.Get(context.Background(), number)
+		var status xkcd.StatusError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			s.logger.Info("skipping missing xkcd comic", "number", number)
+			if err := s.catalogue.markMissing(number); err != nil {
+				s.logger.Warn("failed to save xkcd seen file", "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			return comic, fmt.Errorf("failed to fetch xkcd comic %d: %w", number, err)
+		}
+
+		if err := s.catalogue.markSeen(number); err != nil {
+			s.logger.Warn("failed to save xkcd seen file", "error", err)
+		}
+		if s.prefer2x {
+			comic.ImageURL = s.highRes(comic.ImageURL)
+		}
+
+		s.logger.Debug("fetched xkcd comic", "number", comic.Number, "title", comic.Title, "image", comic.ImageURL,
+			"remaining", s.catalogue.remaining(latest))
+		return comic, nil
+	}
+
+	return xkcd.Comic{}, fmt.Errorf("failed to find an xkcd comic after %d attempts", maxAttempts)
+}
+
+// latestNumber returns the number of the latest comic, asking the API at
+// most once per LatestTTL. If the API fails, a previously fetched number is
+// used regardless of its age.
+func (s *Service) latestNumber() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latest > 0 && s.now().Sub(s.latestAt) < s.latestTTL {
+		return s.latest, nil
+	}
+
 	latest, err := s.client.Latest(context.Background())
 	if err != nil {
-		return xkcd.Comic{}, fmt.Errorf("failed to fetch latest xkcd comic: %w", err)
+		if s.latest > 0 {
+			s.logger.Warn("failed to refresh latest xkcd comic, using cached number", "number", s.latest, "error", err)
+			return s.latest, nil
+		}
+		return 0, fmt.Errorf("failed to fetch latest xkcd comic: %w", err)
 	}
 
-	// Generate a cryptographically secure random number from 1 to latest.Number (inclusive)
-	// rand.Int generates [0, latest.Number), so we add 1 to get [1, latest.Number]
-	randNum, err := rand.Int(rand.Reader, big.NewInt(int64(latest.Number)))
+	s.latest, s.latestAt = latest.Number, s.now()
+	return s.latest, nil
+}
+
+// highRes returns the double resolution version of imageURL if the server
+// has one, or imageURL itself otherwise. Only some comics have them, named
+// like foo_2x.png next to foo.png.
+func (s *Service) highRes(imageURL string) string {
+	ext := path.Ext(imageURL)
+	if ext == "" {
+		return imageURL
+	}
+	candidate := strings.TrimSuffix(imageURL, ext) + "_2x" + ext
+
+	ctx, cancel := context.WithTimeout(context.Background(), highResTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, candidate, nil)
 	if err != nil {
-		return xkcd.Comic{}, fmt.Errorf("failed to generate random number: %w", err)
+		return imageURL
 	}
-	number := int(randNum.Int64()) + 1 // Convert from 0-based to 1-based comic numbering
-	comic, err := s.client.Get(context.Background(), number)
+	resp, err := s.client.HTTPClient.Do(req)
 	if err != nil {
-		return comic, fmt.Errorf("failed to fetch xkcd comic %d: %w", number, err)
+		s.logger.Debug("failed to check for 2x xkcd image", "url", candidate, "error", err)
+		return imageURL
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return imageURL
 	}
+	return candidate
+}
+
+// Permalink returns the xkcd.com page for a comic
+func Permalink(number int) string {
+	return fmt.Sprintf("https://xkcd.com/%d/", number)
+}
+
+// Published returns the date a comic was published, or the zero time if the
+// API didn't report one
+func Published(comic xkcd.Comic) time.Time {
+	if comic.Year == 0 || comic.Month == 0 || comic.Day == 0 {
+		return time.Time{}
+	}
+	return time.Date(comic.Year, time.Month(comic.Month), comic.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// Caption formats a comic's title, number, date, alt text and permalink for
+// display under the image, followed by the transcript if requested
+func Caption(comic xkcd.Comic, transcript bool) string {
+	heading := fmt.Sprintf("%s (#%d", comic.Title, comic.Number)
+	if published := Published(comic); !published.IsZero() {
+		heading += ", " + published.Format(time.DateOnly)
+	}
+	heading += ")"
 
-	s.logger.Debug("fetched xkcd comic", "number", comic.Number, "title", comic.Title)
-	return comic, nil
+	lines := []string{heading}
+	if comic.Alt != "" {
+		lines = append(lines, comic.Alt)
+	}
+	lines = append(lines, Permalink(comic.Number))
+	if transcript && comic.Transcript != "" {
+		lines = append(lines, "", strings.TrimSpace(comic.Transcript))
+	}
+	return strings.Join(lines, "\n")
 }
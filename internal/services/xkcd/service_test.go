@@ -1,14 +1,27 @@
 package xkcd
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/nishanths/go-xkcd/v2"
 )
 
 func TestNewService(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service := NewService(logger)
+	service, err := NewService(Options{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	if service == nil {
 		t.Fatal("expected service but got nil")
@@ -25,7 +38,10 @@ func TestNewService(t *testing.T) {
 
 func TestService_GetRandom(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service := NewService(logger)
+	service, err := NewService(Options{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// Test that GetRandom returns a comic
 	comic, err := service.GetRandom()
@@ -54,7 +70,10 @@ func TestService_GetRandom(t *testing.T) {
 
 func TestService_GetRandom_MultipleCalls(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service := NewService(logger)
+	service, err := NewService(Options{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// Test multiple calls to ensure randomness
 	comics := make(map[int]bool)
@@ -76,3 +95,213 @@ func TestService_GetRandom_MultipleCalls(t *testing.T) {
 		t.Log("Got same comic multiple times (this can happen with random selection)")
 	}
 }
+
+func TestService_highRes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("expected HEAD request, got %s", r.Method)
+		}
+		if r.URL.Path != "/comics/big_2x.png" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		imageURL string
+		want     string
+	}{
+		{name: "2x available", imageURL: server.URL + "/comics/big.png", want: server.URL + "/comics/big_2x.png"},
+		{name: "2x missing", imageURL: server.URL + "/comics/small.png", want: server.URL + "/comics/small.png"},
+		{name: "no extension", imageURL: server.URL + "/comics/big", want: server.URL + "/comics/big"},
+		{name: "unreachable", imageURL: "http://127.0.0.1:0/big.png", want: "http://127.0.0.1:0/big.png"},
+	}
+
+	service, err := NewService(Options{Prefer2x: true}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.highRes(tt.imageURL); got != tt.want {
+				t.Errorf("highRes(%q) = %q, want %q", tt.imageURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaption(t *testing.T) {
+	comic := xkcd.Comic{
+		Number:     327,
+		Title:      "Exploits of a Mom",
+		Alt:        "Her daughter is named Help I'm trapped in a driver's license factory.",
+		Transcript: "[[A mom on the phone]]\n",
+		Year:       2007,
+		Month:      10,
+		Day:        10,
+	}
+
+	tests := []struct {
+		name       string
+		comic      xkcd.Comic
+		transcript bool
+		want       string
+	}{
+		{
+			name:  "without transcript",
+			comic: comic,
+			want: "Exploits of a Mom (#327, 2007-10-10)\n" +
+				"Her daughter is named Help I'm trapped in a driver's license factory.\n" +
+				"https://xkcd.com/327/",
+		},
+		{
+			name:       "with transcript",
+			comic:      comic,
+			transcript: true,
+			want: "Exploits of a Mom (#327, 2007-10-10)\n" +
+				"Her daughter is named Help I'm trapped in a driver's license factory.\n" +
+				"https://xkcd.com/327/\n\n[[A mom on the phone]]",
+		},
+		{
+			name:  "no date or alt text",
+			comic: xkcd.Comic{Number: 1, Title: "Barrel - Part 1"},
+			want:  "Barrel - Part 1 (#1)\nhttps://xkcd.com/1/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Caption(tt.comic, tt.transcript); got != tt.want {
+				t.Errorf("Caption() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestAPI serves comics 1 to latest, except for the missing numbers, and
+// counts requests for the latest comic
+func newTestAPI(t *testing.T, latest int, missing ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var latestCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := latest
+		if r.URL.Path == "/info.0.json" {
+			latestCalls.Add(1)
+		} else if _, err := fmt.Sscanf(r.URL.Path, "/%d/info.0.json", &number); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if number > latest || slices.Contains(missing, number) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"num":%d,"title":"Comic %d","img":"https://imgs.xkcd.com/comics/%d.png","day":"1","month":"1","year":"2020"}`, number, number, number)
+	}))
+	t.Cleanup(server.Close)
+	return server, &latestCalls
+}
+
+func TestService_GetRandom_NoRepeats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	api, latestCalls := newTestAPI(t, 6, 3)
+	seenFile := filepath.Join(t.TempDir(), "seen.json")
+
+	newService := func() *Service {
+		service, err := NewService(Options{LatestTTL: time.Hour, SeenFile: seenFile, Exclude: []int{2}}, logger)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		service.client.BaseURL = api.URL
+		return service
+	}
+
+	// 404 is missing, 2 is excluded and 3 doesn't exist, leaving 1, 4, 5 and 6
+	service := newService()
+	fetched := make(map[int]bool)
+	for range 2 {
+		comic, err := service.GetRandom()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fetched[comic.Number] {
+			t.Errorf("comic %d fetched twice", comic.Number)
+		}
+		fetched[comic.Number] = true
+	}
+
+	// The seen comics survive a restart
+	service = newService()
+	for range 2 {
+		comic, err := service.GetRandom()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fetched[comic.Number] {
+			t.Errorf("comic %d fetched twice", comic.Number)
+		}
+		fetched[comic.Number] = true
+	}
+
+	if want := map[int]bool{1: true, 4: true, 5: true, 6: true}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+	if got := latestCalls.Load(); got != 2 {
+		t.Errorf("expected the latest comic to be fetched once per service, got %d calls", got)
+	}
+
+	// With the archive exhausted, sampling starts over
+	comic, err := service.GetRandom()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fetched[comic.Number] {
+		t.Errorf("unexpected comic %d after starting over", comic.Number)
+	}
+}
+
+func TestService_latestNumber(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	api, latestCalls := newTestAPI(t, 10)
+
+	service, err := NewService(Options{LatestTTL: time.Minute}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.client.BaseURL = api.URL
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		down      bool
+		want      int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "first call", want: 10, wantCalls: 1},
+		{name: "within ttl", advance: 30 * time.Second, want: 10, wantCalls: 1},
+		{name: "after ttl", advance: time.Minute, want: 10, wantCalls: 2},
+		{name: "api down uses cached number", advance: time.Minute, down: true, want: 10, wantCalls: 2},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.down {
+			api.Close()
+		}
+		got, err := service.latestNumber()
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: got %d, want %d", step.name, got, step.want)
+		}
+		if calls := latestCalls.Load(); calls != step.wantCalls {
+			t.Errorf("%s: expected %d calls, got %d", step.name, step.wantCalls, calls)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// Socket is a listening socket passed in by systemd
+type Socket struct {
+	// Name is set with FileDescriptorName= in the socket unit
+	Name     string
+	Listener net.Listener
+}
+
+// Listeners returns the sockets passed by systemd socket activation, or none
+// if the process wasn't socket activated. The activation variables are
+// unset so they aren't inherited by child processes.
+func Listeners() ([]Socket, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	return fileListeners(listenFDsStart, count, names)
+}
+
+// fileListeners wraps count consecutive file descriptors starting at start
+func fileListeners(start, count int, names []string) ([]Socket, error) {
+	sockets := make([]Socket, 0, count)
+	for i := range count {
+		fd := start + i
+		syscall.CloseOnExec(fd)
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, s := range sockets {
+				s.Listener.Close()
+			}
+			return nil, fmt.Errorf("failed to use activated socket %s (fd %d): %w", name, fd, err)
+		}
+
+		sockets = append(sockets, Socket{Name: name, Listener: l})
+	}
+	return sockets, nil
+}
@@ -0,0 +1,101 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListeners_NotActivated(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{name: "no environment"},
+		{name: "other process", pid: strconv.Itoa(os.Getpid() + 1), fds: "1"},
+		{name: "no sockets", pid: strconv.Itoa(os.Getpid()), fds: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			t.Setenv("LISTEN_FDNAMES", "motd")
+
+			sockets, err := Listeners()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(sockets) != 0 {
+				t.Errorf("expected no sockets, got %d", len(sockets))
+			}
+			for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+				if _, ok := os.LookupEnv(key); ok {
+					t.Errorf("expected %s to be unset", key)
+				}
+			}
+		})
+	}
+}
+
+func TestFileListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// A duplicate descriptor stands in for one passed by systemd
+	file, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("failed to get listener file: %v", err)
+	}
+	fd, err := syscall.Dup(int(file.Fd()))
+	file.Close()
+	if err != nil {
+		t.Fatalf("failed to dup listener: %v", err)
+	}
+
+	sockets, err := fileListeners(fd, 1, []string{"motd"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sockets) != 1 || sockets[0].Name != "motd" {
+		t.Fatalf("expected one socket named motd, got %+v", sockets)
+	}
+	defer sockets[0].Listener.Close()
+
+	if got, want := sockets[0].Listener.Addr().String(), l.Addr().String(); got != want {
+		t.Errorf("expected address %s, got %s", want, got)
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	conn.Close()
+	accepted, err := sockets[0].Listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept on activated socket: %v", err)
+	}
+	accepted.Close()
+}
+
+func TestFileListeners_NotSocket(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "fd")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatalf("failed to dup file: %v", err)
+	}
+	file.Close()
+
+	if _, err := fileListeners(fd, 1, nil); err == nil {
+		t.Error("expected error for non-socket descriptor but got none")
+	}
+}
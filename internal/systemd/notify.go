@@ -0,0 +1,82 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notifier sends service state notifications to systemd. A nil Notifier,
+// returned when not running under systemd, ignores all notifications.
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// NewNotifier returns a notifier for the socket in NOTIFY_SOCKET, or nil if
+// it isn't set
+func NewNotifier() *Notifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// Abstract socket names start with "@", which the net package handles
+	return &Notifier{addr: &net.UnixAddr{Name: path, Net: "unixgram"}}
+}
+
+// Notify sends a raw state string such as "READY=1"
+func (n *Notifier) Notify(state string) error {
+	if n == nil {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// Ready tells systemd that startup has finished
+func (n *Notifier) Ready() error {
+	return n.Notify("READY=1")
+}
+
+// Stopping tells systemd that shutdown has begun
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Status sets the free-form status shown by systemctl status
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+// Watchdog tells systemd the service is still healthy
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec=,
+// or false if the watchdog isn't enabled for this process
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	if v := os.Getenv("WATCHDOG_PID"); v != "" {
+		pid, err := strconv.Atoi(v)
+		if err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
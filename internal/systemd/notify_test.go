@@ -0,0 +1,93 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	notifier := NewNotifier()
+
+	tests := []struct {
+		name   string
+		notify func() error
+		want   string
+	}{
+		{name: "ready", notify: notifier.Ready, want: "READY=1"},
+		{name: "status", notify: func() error { return notifier.Status("serving 12 items") }, want: "STATUS=serving 12 items"},
+		{name: "watchdog", notify: notifier.Watchdog, want: "WATCHDOG=1"},
+		{name: "stopping", notify: notifier.Stopping, want: "STOPPING=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.notify(); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			buf := make([]byte, 256)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("failed to read notification: %v", err)
+			}
+			if got := string(buf[:n]); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNotifier_Disabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	notifier := NewNotifier()
+	if notifier != nil {
+		t.Fatal("expected nil notifier without NOTIFY_SOCKET")
+	}
+	if err := notifier.Ready(); err != nil {
+		t.Errorf("expected nil notifier to ignore notifications, got %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name   string
+		usec   string
+		pid    string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second, wantOK: true},
+		{name: "enabled for this process", usec: "5000000", pid: pid, want: 5 * time.Second, wantOK: true},
+		{name: "enabled for another process", usec: "5000000", pid: "1"},
+		{name: "invalid", usec: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, ok := WatchdogInterval()
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -1,80 +1,14 @@
 package main
 
 import (
-	"context"
-	"flag"
-	"fmt"
-	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
 
-	"github.com/stevielcb/motd-server/app"
-	"github.com/stevielcb/motd-server/internal/config"
+	"github.com/stevielcb/motd-server/internal/cli"
 )
 
 // version will be set during build time via ldflags
 var version = "dev"
 
 func main() {
-	// Parse command line flags
-	var showVersion bool
-	flag.BoolVar(&showVersion, "version", false, "Show version information")
-	flag.Parse()
-
-	if showVersion {
-		fmt.Printf("motd-server version %s\n", version)
-		os.Exit(0)
-	}
-
-	// Initialize structured logger
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-	slog.SetDefault(logger)
-
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		logger.Error("failed to load configuration", "error", err)
-		os.Exit(1)
-	}
-
-	// Create application
-	application, err := app.New(cfg, logger)
-	if err != nil {
-		logger.Error("failed to create application", "error", err)
-		os.Exit(1)
-	}
-
-	// Handle graceful shutdown with context
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		logger.Info("received shutdown signal")
-		cancel() // Signal main function to exit gracefully
-	}()
-
-	// Start application
-	if err := application.Start(); err != nil {
-		logger.Error("failed to start application", "error", err)
-		os.Exit(1)
-	}
-
-	// Wait for shutdown signal
-	<-ctx.Done()
-	logger.Info("shutting down application")
-
-	// Stop application gracefully
-	if err := application.Stop(); err != nil {
-		logger.Error("failed to stop application gracefully", "error", err)
-		os.Exit(1)
-	}
-
-	logger.Info("application stopped successfully")
+	os.Exit(cli.Run(os.Args[1:], version, os.Stdout, os.Stderr))
 }